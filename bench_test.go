@@ -0,0 +1,49 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+// The benchmarks below run every expression of tests once per iteration,
+// through the tree walker and through the bytecode machine.
+
+func BenchmarkEval(b *testing.B) {
+	nodes := make([]parser.Node, len(tests))
+	for i, test := range tests {
+		nodes[i], _ = Parse(test.expr)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, node := range nodes {
+			node.Eval(tests[j].env)
+		}
+	}
+}
+
+func BenchmarkEvalE(b *testing.B) {
+	nodes := make([]parser.Node, len(tests))
+	for i, test := range tests {
+		nodes[i], _ = Parse(test.expr)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, node := range nodes {
+			parser.EvalE(node, tests[j].env)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	progs := make([]*Program, len(tests))
+	for i, test := range tests {
+		progs[i], _ = Compile(test.expr)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, prog := range progs {
+			prog.Run(tests[j].env)
+		}
+	}
+}
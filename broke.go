@@ -2,8 +2,8 @@ package eval
 
 import "github.com/Cauchy-NY/eval/parser"
 
-func Parse(input string) (parser.Node, error) {
-	expr, err := parser.Parse(input)
+func Parse(input string, opts ...parser.Option) (parser.Node, error) {
+	expr, err := parser.Parse(input, opts...)
 	if err != nil {
 		return nil, err
 	}
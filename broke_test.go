@@ -8,6 +8,21 @@ import (
 	"testing"
 )
 
+type profile struct {
+	Age  int
+	Tags []string
+	Refs map[int]string
+	note string
+}
+
+var user = parser.Env{
+	"name":    "Tom",
+	"profile": map[string]interface{}{"age": 18, "tags": []interface{}{"cpp", "golang"}},
+	"scores":  [3]float64{0.5, 0.9, 0.1},
+	"attrs":   map[string]string{"k": "v"},
+	"p":       &profile{Age: 30, Tags: []string{"vip"}, Refs: map[int]string{7: "seven"}},
+}
+
 var tests = []struct {
 	expr string
 	env  parser.Env
@@ -29,6 +44,8 @@ var tests = []struct {
 	{"5.0 / 9 * (x - 32)", parser.Env{"x": -40}, float64(-40)},
 	{"5.0 / 9 * (x - 32)", parser.Env{"x": 212}, float64(100)},
 	{"greet + name", parser.Env{"greet": "hello,", "name": " world"}, "hello, world"},
+	{`"say \"hi\"\n" + 'x' + '\''`, parser.Env{}, "say \"hi\"\nx'"},
+	{"`C:\\dir\\` + name", parser.Env{"name": "file"}, `C:\dir\file`},
 	// logical tests
 	{"!true", parser.Env{}, false},
 	{"false", parser.Env{}, false},
@@ -71,6 +88,144 @@ var tests = []struct {
 	{"has_prefix(\"golang is a beautiful language\", x)", parser.Env{"x": "php"}, false},
 	{"has_suffix(\"golang is a beautiful language\", x)", parser.Env{"x": "language"}, true},
 	{"has_suffix(\"golang is a beautiful language\", x)", parser.Env{"x": "beautiful"}, false},
+	// member and index tests
+	{"user.profile.age", parser.Env{"user": user}, 18},
+	{"user.profile.tags[1]", parser.Env{"user": user}, "golang"},
+	{"user.profile.tags[i] == \"cpp\"", parser.Env{"user": user, "i": 0}, true},
+	{"user.scores[2 - 1] > 0.86", parser.Env{"user": user}, true},
+	{"user.attrs[\"k\"]", parser.Env{"user": user}, "v"},
+	{"user.attrs[\"missing\"]", parser.Env{"user": user}, nil},
+	{"user.profile.missing", parser.Env{"user": user}, nil},
+	{"user[\"name\"] + \"!\"", parser.Env{"user": user}, "Tom!"},
+	{"user.p.Age + 1", parser.Env{"user": user}, int64(31)},
+	{"user.p.Tags[0]", parser.Env{"user": user}, "vip"},
+	{"user.p.Refs[7]", parser.Env{"user": user}, "seven"},
+	{"user.p.Refs[8]", parser.Env{"user": user}, nil},
+	{"-user.profile.age", parser.Env{"user": user}, -18},
+	{"[1, [2, 3]][1][0]", parser.Env{}, int64(2)},
+	// map tests
+	{"{\"vip\": 0.9, \"normal\": 0.86}[user_type]", parser.Env{"user_type": "vip"}, 0.9},
+	{"{\"vip\": 0.9, \"normal\": 0.86}[user_type]", parser.Env{"user_type": "org"}, nil},
+	{"{1: \"one\", 2.5: \"two and a half\"}[x]", parser.Env{"x": 1}, "one"},
+	{"{1: \"one\", 2.5: \"two and a half\"}[x]", parser.Env{"x": 2.5}, "two and a half"},
+	{"{\"a\": {\"b\": [1, 2]}}.a.b[1]", parser.Env{}, int64(2)},
+	{"{}", parser.Env{}, map[interface{}]interface{}{}},
+	{"{k: 1}", parser.Env{"k": uint8(3)}, map[interface{}]interface{}{int64(3): int64(1)}},
+	{"{\"a\": 1, \"b\": [2]} == {\"b\": [2], \"a\": 1}", parser.Env{}, true},
+	{"{\"a\": 1} == {\"a\": 2}", parser.Env{}, false},
+	{"{\"a\": 1} != {\"b\": 1}", parser.Env{}, true},
+	{"m == {\"a\": 1, \"b\": 2}", parser.Env{"m": map[string]int{"a": 1, "b": 2}}, true},
+	{"len({\"a\": 1, \"b\": 2})", parser.Env{}, int64(2)},
+	{"len(m)", parser.Env{"m": map[string]int{"a": 1}}, int64(1)},
+	{"len([1, 2, 3])", parser.Env{}, int64(3)},
+	{"user_type in {\"big_v\": 1, \"org\": 2}", parser.Env{"user_type": "org"}, true},
+	{"user_type not_in {\"big_v\": 1, \"org\": 2}", parser.Env{"user_type": "org"}, false},
+	{"7 in m", parser.Env{"m": map[int]string{7: "seven"}}, true},
+	{"x in [1, 2]", parser.Env{"x": 2}, true},
+	{"2.0 in [1, 2] && 2.0 in {2: \"x\"} && 1 == 1.0", parser.Env{}, true},
+	{"{1: 2}[1.0]", parser.Env{}, int64(2)},
+	{"{x: \"a\"}[2]", parser.Env{"x": float32(2)}, "a"},
+	{"{2.5: 1}[x]", parser.Env{"x": 2}, nil},
+	// conditional tests
+	{"user_type == \"vip\" ? 0.95 : 0.86", parser.Env{"user_type": "vip"}, 0.95},
+	{"user_type == \"vip\" ? 0.95 : 0.86", parser.Env{"user_type": "normal"}, 0.86},
+	{"a > 0 ? \"pos\" : a < 0 ? \"neg\" : \"zero\"", parser.Env{"a": 1}, "pos"},
+	{"a > 0 ? \"pos\" : a < 0 ? \"neg\" : \"zero\"", parser.Env{"a": -1}, "neg"},
+	{"a > 0 ? \"pos\" : a < 0 ? \"neg\" : \"zero\"", parser.Env{"a": 0}, "zero"},
+	{"a || b ? 1 : 2", parser.Env{"a": false, "b": true}, int64(1)},
+	{"(a ? 1 : 2) + 10", parser.Env{"a": false}, int64(12)},
+	{"a ? b ? 1 : 2 : 3", parser.Env{"a": true, "b": false}, int64(2)},
+	{"{\"k\": a ? 1 : 2}[\"k\"]", parser.Env{"a": true}, int64(1)},
+	{"ok ? x : x / y", parser.Env{"ok": true, "x": 1, "y": 0}, 1},
+	// null tests
+	{"null", parser.Env{}, nil},
+	{"x == nil", parser.Env{}, true},
+	{"x != null", parser.Env{"x": 0}, true},
+	{"x == null", parser.Env{"x": []int(nil)}, true},
+	{"x > 3 || x <= 3", parser.Env{}, false},
+	{`null < "a" || null >= "a"`, parser.Env{}, false},
+	{"x ?? 1", parser.Env{}, int64(1)},
+	{"x ?? 1", parser.Env{"x": 0}, 0},
+	{"score ?? 0 > 0.5", parser.Env{"score": 0.9}, true},
+	{"score ?? 0 > 0.5", parser.Env{}, false},
+	{"user.nick ?? user.name", parser.Env{"user": user}, "Tom"},
+	{"a?.b", parser.Env{}, nil},
+	{"a?.b.c[0]", parser.Env{}, nil},
+	{"a?.b.c", parser.Env{"a": map[string]interface{}{"b": nil}}, nil},
+	{"a?.[0]", parser.Env{}, nil},
+	{"a?.[0] ?? -1", parser.Env{"a": []int{5}}, 5},
+	{"user?.profile.age", parser.Env{"user": user}, 18},
+	{"x in [null, 1]", parser.Env{}, true},
+	{"null ?? null ?? 2", parser.Env{}, int64(2)},
+	// regular expression tests
+	{`title =~ "(?i)free\\s+money"`, parser.Env{"title": "Get FREE  money now"}, true},
+	{"title =~ `(?i)free\\s+money`", parser.Env{"title": "free-money"}, false},
+	{`title !~ "^re:"`, parser.Env{"title": "re: hi"}, false},
+	{`title matches p`, parser.Env{"title": "abc", "p": "b+"}, true},
+	{`s =~ "^" + "a" && s !~ "z"`, parser.Env{"s": "abc"}, true},
+	{"regex_extract(s, `(\\d+)-(\\d+)`, 2)", parser.Env{"s": "call 555-1234"}, "1234"},
+	{`regex_extract(s, "[0-9]+")`, parser.Env{"s": "no digits"}, ""},
+	{`regex_replace(s, "([a-z]+)@([a-z]+)", "$1 at $2")`, parser.Env{"s": "tom@example"}, "tom at example"},
+	// collection tests
+	{`any(tags, # in ["gambling", "porn"])`, parser.Env{"tags": []string{"news", "porn"}}, true},
+	{`any(tags, # in ["gambling", "porn"])`, parser.Env{"tags": []string{"news"}}, false},
+	{"all(scores, # < 0.5)", parser.Env{"scores": []float64{0.1, 0.4}}, true},
+	{"all(scores, # < 0.5)", parser.Env{"scores": []float64{0.1, 0.9}}, false},
+	{"all(scores, # < 0.5)", parser.Env{}, true},
+	{"none(user.profile.tags, # == \"java\")", parser.Env{"user": user}, true},
+	{"count(xs, # % 2 == 0)", parser.Env{"xs": []int{1, 2, 3, 4}}, int64(2)},
+	{"filter(xs, # > 2)", parser.Env{"xs": []int{1, 2, 3, 4}}, []interface{}{3, 4}},
+	{"filter(xs, # > 9)", parser.Env{"xs": []int{1, 2}}, []interface{}(nil)},
+	{"map(items, #.id)", parser.Env{"items": []interface{}{map[string]int{"id": 1}, map[string]int{"id": 2}}}, []interface{}{1, 2}},
+	{"map(filter(items, #.price > 10), #.id)", parser.Env{"items": []map[string]int{{"id": 1, "price": 5}, {"id": 2, "price": 20}}}, []interface{}{2}},
+	{"any(groups, all(#, # > 0))", parser.Env{"groups": [][]int{{1, -1}, {2, 3}}}, true},
+	{"any(groups, any(#, # > x))", parser.Env{"groups": [][]int{{1}, {2}}, "x": 2}, false},
+	{"any(xs, 10 / # > 1)", parser.Env{"xs": []int{1, 0}}, true}, // stops before dividing by 0
+	{"any([1, 2], # == 2) && len(map([1, 2, 3], # * 2)) == 3", parser.Env{}, true},
+	// bitwise tests
+	{"perms & 4 != 0", parser.Env{"perms": 6}, true},
+	{"perms & 4 != 0", parser.Env{"perms": 3}, false},
+	{"flags | 1 << 3", parser.Env{"flags": 1}, int64(9)},
+	{"flags &^ 1 ^ 2", parser.Env{"flags": 7}, int64(4)},
+	{"x >> 2 + 1", parser.Env{"x": 16}, int64(5)},
+	{"^x", parser.Env{"x": 0}, -1},
+	{"^m", parser.Env{"m": uint8(1)}, uint8(254)},
+	{"m << 1", parser.Env{"m": uint8(200)}, uint8(144)},
+	{"1 << m", parser.Env{"m": uint8(62)}, int64(1) << 62},
+	{"a & b == b", parser.Env{"a": uint16(0xff), "b": 0x0f}, true},
+	// power tests
+	{"2 ** 10", parser.Env{}, int64(1024)},
+	{"2 ** 3 ** 2", parser.Env{}, int64(512)},
+	{"-2 ** 2", parser.Env{}, int64(-4)},
+	{"(-2) ** 2", parser.Env{}, int64(4)},
+	{"-x ** 2 + 1", parser.Env{"x": 3}, int64(-8)},
+	{"2 ** -x ** 2", parser.Env{"x": 1}, 0.5},
+	{"3 * 2 ** 2", parser.Env{}, int64(12)},
+	{"2 ** -1", parser.Env{}, 0.5},
+	{"x ** 0.5", parser.Env{"x": 16}, 4.0},
+	{"n ** 0", parser.Env{"n": 7.5}, 1.0},
+	{"n ** 2 == 9", parser.Env{"n": uint8(3)}, true},
+	{"x ** y", parser.Env{"x": int8(100), "y": int8(2)}, int8(16)},
+	{"x ** 2 == x * 100", parser.Env{"x": int8(100)}, true},
+	{"x ** y", parser.Env{"x": uint64(1<<63 + 3), "y": uint64(1)}, uint64(1<<63 + 3)},
+	{"x ** 2 == x * x", parser.Env{"x": uint64(1<<63 + 3)}, true},
+	{"x ** -1", parser.Env{"x": int8(4)}, 0.25},
+	{"x ** 2", parser.Env{"x": float32(1.5)}, float32(2.25)},
+	// let tests
+	{"let r = (a + b) / total; r > 0.3 && r < 0.9", parser.Env{"a": 1, "b": 2, "total": 5.0}, true},
+	{"let s = a + b; 2 < s && s <= 9", parser.Env{"a": 3, "b": 7}, false},
+	{"let y = x * 2; let z = y + 1; z * y", parser.Env{"x": 3}, int64(42)},
+	{`let name = "Jim"; name`, parser.Env{"name": "Tom"}, "Jim"},
+	{"(let k = 2; k * k) + x", parser.Env{"x": 1}, int64(5)},
+	{"let u = user.profile; defined(u.age) && u.age > 10", parser.Env{"user": user}, true},
+	{"let u = user.nobody; default(u.age, 0) ?? 1", parser.Env{"user": user}, int64(0)},
+	{"let lo = 0.5; any(xs, let d = # - lo; d > 0)", parser.Env{"xs": []float64{0.1, 0.7}}, true},
+	{"ok ? let n = lower(name); n + n : name", parser.Env{"ok": true, "name": "AB"}, "abab"},
+	{"let r = a / b; b == 0 ? 0 : r", parser.Env{"a": 6, "b": 0}, int64(0)},
+	{"let r = a / b; b == 0 ? 0 : r", parser.Env{"a": 6, "b": 2}, 3},
+	{`let r = lower(a); false && r == "x"`, parser.Env{"a": 1}, false},
+	{"any(xs, let y = #; all(ys, # != y))", parser.Env{"xs": []int{1}, "ys": []int{2}}, true},
+	{"let a = x + 1; let b = (let c = a * 2; c + a); b + a", parser.Env{"x": 1}, int64(8)},
 }
 
 func TestEval(t *testing.T) {
@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestCheck(t *testing.T) {
+	schema := parser.Schema{
+		"a":            parser.IntType,
+		"b":            parser.IntType,
+		"x":            parser.FloatType,
+		"name":         parser.StringType,
+		"ok":           parser.BoolType,
+		"tags":         parser.ArrayOf(parser.StringType),
+		"user":         parser.MapOf(parser.AnyType),
+		"scores":       parser.MapOf(parser.FloatType),
+		"pron_predict": parser.FloatType,
+		"user_type":    parser.StringType,
+	}
+	for _, test := range []struct {
+		expr string
+		want string // result type or errors
+	}{
+		{"1 + 2 * a", "int"},
+		{"5.0 / 9 * (x - 32)", "float"},
+		{`name + "!"`, "string"},
+		{"2 < (a + b) && (a + b) <= 9", "bool"},
+		{`pron_predict > 0.86 && user_type not_in ["big_v", "org"]`, "bool"},
+		{"tags[0]", "string"},
+		{`scores["vip"] * 2`, "float"},
+		{"user.profile.age", "any"},
+		{`{"vip": 0.9, "normal": 0.86}[user_type]`, "float"},
+		{"[1, 2.5]", "[]any"},
+		{"ok ? 1 : 2", "int"},
+		{"ok ? 1 : name", "any"},
+		{"sqrt(a) + pow(x, 2)", "float"},
+		{"len(tags) + len(name)", "int"},
+		{"defined(missing) && defined(user.nick)", "bool"},
+		{"default(a, 2) * 2", "int"},
+		{"default(missing, 1.5)", "any"},
+		{"a ?? 1", "int"},
+		{"missing ?? 1.5", "any"},
+		{"null", "any"},
+		{"user?.profile?.[0]", "any"},
+		{`name =~ "a+" || regex_extract(name, "b") != ""`, "bool"},
+		{"any(tags, # == name) || all(tags, len(#) > a)", "bool"},
+		{"count(user.items, #.price > x)", "int"},
+		{`filter(tags, # != "")`, "[]string"},
+		{"map(tags, len(#))", "[]int"},
+		{"map(user.items, #.id)", "[]any"},
+		{"let r = a + b; r * 2", "int"},
+		{"^a & b | 1 << a", "int"},
+		{"user.flags & 4 != 0", "bool"},
+		{"a ** 2 + b", "int"},
+		{"a ** x", "float"},
+		{"a ** b", "any"},
+		{"let r = a + x; r > 1 && missing ?? ok", "bool"},
+		{`a =~ "1"`, "1:1: invalid operation: int =~ string"},
+		{`"a" - 1`, "1:1: invalid operation: string - int"},
+		{"sqrt(name)", "1:6: invalid argument 1 to sqrt: string"},
+		{"!a", "1:1: invalid operation: ! int"},
+		{"x % 2", "1:1: invalid operation: float % int"},
+		{"ok && a", "1:1: invalid operation: bool && int"},
+		{"name == 1", "1:1: invalid operation: string == int"},
+		{"a in 3", "1:1: invalid operation: int in int"},
+		{"a ? 1 : 2", "1:1: invalid condition: int is not bool"},
+		{"name.first", "1:1: cannot access field first of string"},
+		{`tags["a"]`, `1:6: invalid array index type string`},
+		{"len(a)", "1:5: invalid argument 1 to len: int"},
+		{"missing > 1", "1:1: undefined variable missing"},
+		{"any(tags, # > 1)", "1:11: invalid operation: string > int"},
+		{"any(tags, #.x)", "1:11: cannot access field x of string"},
+		{"let s = name; s - 1", "1:15: invalid operation: string - int"},
+		{"x << 1", "1:1: invalid operation: float << int"},
+		{"^name", "1:1: invalid operation: ^ string"},
+		{"name ** 2", "1:1: invalid operation: string ** int"},
+		{"any(name, true)", "1:5: invalid argument 1 to any: string"},
+		{`name - 1 > 0 || sin(name) > 0`, "1:1: invalid operation: string - int\n1:21: invalid argument 1 to sin: string"},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		tp, err := parser.Check(node, schema)
+		got := tp.String()
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("Check(%s) = %q, want %q", test.expr, got, test.want)
+		}
+	}
+
+	fs := parser.Builtins()
+	s := parser.NewString("a")
+	for _, test := range []struct {
+		call parser.Node
+		want string
+	}{
+		{parser.NewCall(fs["regex_extract"], s, s, s, s), "too many arguments in call to regex_extract"},
+		{parser.NewCall(fs["regex_extract"], s), "not enough arguments in call to regex_extract"},
+	} {
+		if _, err := parser.Check(test.call, schema); err == nil || !strings.HasSuffix(err.Error(), test.want) {
+			t.Errorf("Check(%s) = %v, want %s", test.call, err, test.want)
+		}
+	}
+}
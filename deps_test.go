@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestDeps(t *testing.T) {
+	for _, test := range []struct {
+		expr  string
+		vars  []string
+		funcs []string
+		paths []string
+	}{
+		{"1 + 2", []string{}, []string{}, []string{}},
+		{`pron_predict > 0.86 && user_type not_in ["big_v", "org"]`,
+			[]string{"pron_predict", "user_type"}, []string{}, []string{"pron_predict", "user_type"}},
+		{"sqrt(x) + pow(x, y) > sqrt(2)",
+			[]string{"x", "y"}, []string{"pow", "sqrt"}, []string{"x", "y"}},
+		{"user.profile.age > 18 || len(user.profile) > 0",
+			[]string{"user"}, []string{"len"}, []string{"user.profile", "user.profile.age"}},
+		{`tags[0] == attrs["k"].v`,
+			[]string{"attrs", "tags"}, []string{}, []string{`attrs["k"].v`, "tags[0]"}},
+		{"user.tags[i].name",
+			[]string{"i", "user"}, []string{}, []string{"i", "user.tags"}},
+		{"m[user.key][0]",
+			[]string{"m", "user"}, []string{}, []string{"m", "user.key"}},
+		{`{"a": x.y}[default(k, "a")] ? [len(z)] : []`,
+			[]string{"k", "x", "z"}, []string{"default", "len"}, []string{"k", "x.y", "z"}},
+		{`lower(name).x`,
+			[]string{"name"}, []string{"lower"}, []string{"name"}},
+		{"let u = user.profile; u.age > x",
+			[]string{"user", "x"}, []string{}, []string{"user.profile", "x"}},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := parser.Vars(node); !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("Vars(%s) = %q, want %q", test.expr, got, test.vars)
+		}
+		if got := parser.Funcs(node); !reflect.DeepEqual(got, test.funcs) {
+			t.Errorf("Funcs(%s) = %q, want %q", test.expr, got, test.funcs)
+		}
+		if got := parser.Paths(node); !reflect.DeepEqual(got, test.paths) {
+			t.Errorf("Paths(%s) = %q, want %q", test.expr, got, test.paths)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package eval
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{"a and b or not c", "a && b || !c"},
+		{"x gt 1 AND y le 2", "x > 1 && y <= 2"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"a + (b * c)", "a + b * c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"(a || b) && c", "(a || b) && c"},
+		{"-(a + b)", "-(a + b)"},
+		{"!(!ok)", "!!ok"},
+		{"- -x", "--x"},
+		{"(x in tags) == T", "x in tags == true"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e"},
+		{"a ? (b ? c : d) : e", "a ? b ? c : d : e"},
+		{"(a > 1 ? b : c) + 1", "(a > 1 ? b : c) + 1"},
+		{"user . profile [ 'k' ] . age", `user.profile["k"].age`},
+		{"(-x).y", "(-x).y"},
+		{"[1,2.0 , 'a',{ \"k\" :v}]", `[1, 2.0, "a", {"k": v}]`},
+		{"x not_in ['a', 'b']", `x not_in ["a", "b"]`},
+		{"pow( x,2 ) > 1e21", "pow(x, 2) > 1e+21"},
+		{"1 + 2 * 3 > x", "7 > x"},
+		{"x - -1", "x - -1"},
+		{"(-1.5).x", "(-1.5).x"},
+		{"a?.b.c[0] ?? NULL", "a?.b?.c?.[0] ?? null"},
+		{"(a ?? b) * 2 + (c ?? d)", "(a ?? b) * 2 + (c ?? d)"},
+		{"((a + b) ?? c) > d", "a + b ?? c > d"},
+		{"a ? .5 : b?.c", "a ? 0.5 : b?.c"},
+		{"`a\\b` + '\\'' + \"\\u00e9\\x41\"", `"a\\b'éA"`},
+		{`a matches "x" == (b !~ "y")`, `a =~ "x" == b !~ "y"`},
+		{"let k=x*2;(let j = k; j) + k", "let k = x * 2; (let j = k; j) + k"},
+		{"a|b&c", "a | b & c"},
+		{"(a | b) & c", "(a | b) & c"},
+		{"^(a&^b)<<2", "^(a &^ b) << 2"},
+		{"a ^ (b + c)", "a ^ (b + c)"},
+		{"a ^ b + c", "a ^ b + c"},
+		{"a**b**c", "a ** b ** c"},
+		{"(a ** b) ** c", "(a ** b) ** c"},
+		{"-a ** 2 * b", "-a ** 2 * b"},
+		{"(-a) ** 2", "(-a) ** 2"},
+		{"a ** -b ** 2", "a ** -b ** 2"},
+		{"(a.b[0] ** 2) ** c", "(a.b[0] ** 2) ** c"},
+		{"(let k = x; k > 1) ? (let j = y; j + k) : 0", "(let k = x; k > 1) ? let j = y; j + k : 0"},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := parser.Format(node); got != test.want {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// TestFormatRoundTrip checks that parsing the formatted source of a tree
+// yields the same tree, for every expression the other tests use.
+func TestFormatRoundTrip(t *testing.T) {
+	exprs := []string{
+		`"a\"b" + 'x'`,
+		`'"' + "\\" + "\t\n" + "é"`,
+		"`raw \\d+ \"string\"` + 'x'",
+		`a ? b : c ? d : e`,
+		"((a))",
+		"(1).x",
+		"-(-(x))",
+		"!(a == b) != !c",
+		"a - (b + c) * -(d % e) / f",
+		`default(user.nick, lower(user.name)) in ["tom", "jim"] || defined(x[0])`,
+		"2 ** 63",
+		"x - 2 ** 63 * y",
+		"(-9223372036854775807 - 1).x",
+	}
+	for _, test := range tests {
+		exprs = append(exprs, test.expr)
+	}
+	for _, expr := range exprs {
+		node, err := Parse(expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		src := parser.Format(node)
+		again, err := Parse(src)
+		if err != nil {
+			t.Errorf("%s: formatted as %s, which doesn't parse: %v", expr, src, err)
+			continue
+		}
+		if !sameTree(reflect.ValueOf(node), reflect.ValueOf(again)) {
+			t.Errorf("%s: formatted as %s, which parses to a different tree", expr, src)
+		}
+		if s := parser.Format(again); s != src {
+			t.Errorf("%s: formatted as %s, then as %s", expr, src, s)
+		}
+	}
+}
+
+// sameTree reports whether a and b are deeply equal, ignoring spans.
+func sameTree(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() || a.IsValid() && a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.Kind() == reflect.Ptr && a.Pointer() == b.Pointer() {
+			return true
+		}
+		return sameTree(a.Elem(), b.Elem())
+	case reflect.Struct:
+		if a.Type() == reflect.TypeOf(parser.Span{}) {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !sameTree(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameTree(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			if v := b.MapIndex(k); !v.IsValid() || !sameTree(a.MapIndex(k), v) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func:
+		return a.IsNil() == b.IsNil()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	}
+	return !a.IsValid()
+}
@@ -0,0 +1,170 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestMarshalNode(t *testing.T) {
+	node, err := Parse(`a and !b.c || pow(x[1], 2.5) > 1 ? {"k": -y} : ["s", true]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parser.MarshalNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":1,"expr":{"type":"cond",` +
+		`"cond":{"type":"binary","op":"||",` +
+		`"x":{"type":"binary","op":"\u0026\u0026","x":{"type":"ident","name":"a"},` +
+		`"y":{"type":"unary","op":"!","x":{"type":"member","x":{"type":"ident","name":"b"},"name":"c"}}},` +
+		`"y":{"type":"binary","op":"\u003e",` +
+		`"x":{"type":"call","func":"pow","args":[` +
+		`{"type":"index","x":{"type":"ident","name":"x"},"index":{"type":"int","value":1}},` +
+		`{"type":"float","value":2.5}]},` +
+		`"y":{"type":"int","value":1}}},` +
+		`"x":{"type":"map","entries":[{"key":{"type":"string","value":"k"},` +
+		`"value":{"type":"unary","op":"-","x":{"type":"ident","name":"y"}}}]},` +
+		`"y":{"type":"array","elems":[{"type":"string","value":"s"},{"type":"bool","value":true}]}}}`
+	if string(got) != want {
+		t.Errorf("MarshalNode = %s, want %s", got, want)
+	}
+}
+
+// TestJSONRoundTrip checks that decoding the encoding of a tree yields the
+// same tree, for every expression the other tests use.
+func TestJSONRoundTrip(t *testing.T) {
+	exprs := []string{
+		`a ? b : c ? d : e`,
+		`x in ["tom", "jim"] && y not_in [1, 2.5]`,
+		`default(user.nick, lower(user.name)) != "" || defined(x[0])`,
+		`{1: [], "a": {}}[k]`,
+		`a?.b[0] ?? null`,
+		`any(xs, all(#.tags, # != x))`,
+		`let r = a / b; let s = r * r; s > r`,
+	}
+	for _, test := range tests {
+		exprs = append(exprs, test.expr)
+	}
+	for _, expr := range exprs {
+		node, err := Parse(expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		data, err := parser.MarshalNode(node)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		again, err := parser.UnmarshalNode(data)
+		if err != nil {
+			t.Errorf("%s: encoded as %s, which doesn't decode: %v", expr, data, err)
+			continue
+		}
+		if !sameTree(reflect.ValueOf(node), reflect.ValueOf(again)) {
+			t.Errorf("%s: encoded as %s, which decodes to a different tree", expr, data)
+		}
+	}
+}
+
+func TestUnmarshalNodeErrors(t *testing.T) {
+	ident := `{"type":"ident","name":"x"}`
+	for _, test := range []struct {
+		json, want string
+	}{
+		{`[]`, "decode node: want an object, got an array"},
+		{`{"version":2,"expr":` + ident + `}`, "decode node: /version: unsupported version 2, want 1"},
+		{`{"expr":` + ident + `}`, `decode node: missing field "version"`},
+		{`{"version":1,"expr":` + ident + `,"x":1}`, `decode node: unknown field "x"`},
+		{`{"version":1}`, `decode node: missing field "expr"`},
+		{`{"version":1,"expr":null}`, "decode node: /expr: want a node object, got null"},
+		{`{"version":1,"expr":{"name":"x"}}`, `decode node: /expr: missing field "type"`},
+		{`{"version":1,"expr":{"type":"lambda"}}`, `decode node: /expr/type: unknown node type "lambda"`},
+		{`{"version":1,"expr":{"type":"ident","name":"x","value":1}}`, `decode node: /expr/value: unknown field "value" in ident node`},
+		{`{"version":1,"expr":{"type":"ident","name":"1x"}}`, `decode node: /expr/name: invalid identifier "1x"`},
+		{`{"version":1,"expr":{"type":"ident","name":"and"}}`, `decode node: /expr/name: invalid identifier "and"`},
+		{`{"version":1,"expr":{"type":"int","value":1.5}}`, "decode node: /expr/value: invalid int 1.5"},
+		{`{"version":1,"expr":{"type":"string","value":1}}`, "decode node: /expr/value: invalid value: a number"},
+		{`{"version":1,"expr":{"type":"unary","op":"~","x":` + ident + `}}`, `decode node: /expr/op: unknown unary operator "~"`},
+		{`{"version":1,"expr":{"type":"binary","op":"and","x":` + ident + `,"y":` + ident + `}}`, `decode node: /expr/op: unknown binary operator "and"`},
+		{`{"version":1,"expr":{"type":"binary","op":"+","x":` + ident + `}}`, `decode node: /expr: missing field "y"`},
+		{`{"version":1,"expr":{"type":"cond","cond":` + ident + `,"x":` + ident + `,"y":{}}}`, `decode node: /expr/y: missing field "type"`},
+		{`{"version":1,"expr":{"type":"array","elems":[` + ident + `,1]}}`, "decode node: /expr/elems/1: want a node object, got a number"},
+		{`{"version":1,"expr":{"type":"map","entries":[` +
+			`{"key":{"type":"string","value":"k"},"value":` + ident + `},` +
+			`{"key":{"type":"string","value":"k"},"value":` + ident + `}]}}`,
+			"decode node: /expr/entries/1/key: duplicate key k in map literal"},
+		{`{"version":1,"expr":{"type":"map","entries":[{"key":` + ident + `}]}}`, `decode node: /expr/entries/0: missing field "value"`},
+		{`{"version":1,"expr":{"type":"call","func":"log","args":[]}}`, "decode node: /expr: unknown function log"},
+		{`{"version":1,"expr":{"type":"call","func":"pow","args":[` + ident + `]}}`, "decode node: /expr: not enough arguments in call to pow"},
+		{`{"version":1,"expr":{"type":"binary","op":"+","x":` + ident + `,"y":{"type":"call","func":"sqrt","args":[{"type":"string","value":"s"}]}}}`,
+			"decode node: /expr/y/args/0: invalid argument 1 to sqrt: string"},
+		{`{"version":1,"expr":{"type":"call","func":"defined","args":[{"type":"int","value":1}]}}`,
+			"decode node: /expr/args/0: invalid argument 1 to defined: not a variable or a field of one"},
+		{`{"version":1,"expr":{"type":"member","x":` + ident + `,"name":"a.b"}}`, `decode node: /expr/name: invalid identifier "a.b"`},
+		{`{"version":1,"expr":{"type":"member","x":` + ident + `,"name":"b","optional":"yes"}}`, "decode node: /expr/optional: invalid optional: a string"},
+		{`{"version":1,"expr":{"type":"ident","name":"nil"}}`, `decode node: /expr/name: invalid identifier "nil"`},
+		{`{"version":1,"expr":{"type":"binary","op":"=~","x":` + ident + `,"y":{"type":"string","value":"("}}}`,
+			"decode node: /expr/y: error parsing regexp: missing closing ): `(`"},
+		{`{"version":1,"expr":{"type":"unary","op":"!","x":{"type":"elem"}}}`, "decode node: /expr: # used outside of a predicate"},
+		{`{"version":1,"expr":{"type":"local","name":"r"}}`, "decode node: /expr: r is not bound by an enclosing let"},
+		{`{"version":1,"expr":{"type":"let","name":"r","value":{"type":"local","name":"r"},"body":` + ident + `}}`,
+			"decode node: /expr: r used before it is defined"},
+		{`{"version":1,"expr":{"type":"let","name":"let","value":` + ident + `,"body":` + ident + `}}`, `decode node: /expr/name: invalid identifier "let"`},
+		{`{"version":1,"expr":{"type":"call","func":"any","args":[` + ident + `,{"type":"int","value":1}]}}`,
+			"decode node: /expr/args/1: invalid argument 2 to any: int"},
+	} {
+		_, err := parser.UnmarshalNode([]byte(test.json))
+		var e *parser.DecodeError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got %v, want a *DecodeError", test.json, err)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.json, err, test.want)
+		}
+	}
+}
+
+func TestUnmarshalNodeFunctions(t *testing.T) {
+	data := []byte(`{"version":1,"expr":{"type":"call","func":"twice","args":[{"type":"ident","name":"x"}]}}`)
+	if _, err := parser.UnmarshalNode(data); err == nil {
+		t.Error("unregistered function decoded")
+	}
+	fs := parser.Builtins()
+	fs.Register("twice", func(x int) int { return 2 * x })
+	node, err := parser.UnmarshalNode(data, parser.WithFunctions(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parser.EvalE(node, parser.Env{"x": 21}); err != nil || got != int64(42) {
+		t.Errorf("twice(21) = %v, %v", got, err)
+	}
+}
+
+func TestNodeUnmarshalJSON(t *testing.T) {
+	var b parser.BinaryNode
+	if err := json.Unmarshal([]byte(`{"type":"binary","op":"*","x":{"type":"int","value":6},"y":{"type":"int","value":7}}`), &b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Eval(nil); got != int64(42) {
+		t.Errorf("6 * 7 = %v", got)
+	}
+	var id parser.IdentNode
+	if err := json.Unmarshal([]byte(`{"type":"int","value":1}`), &id); err == nil {
+		t.Error("int node decoded into an IdentNode")
+	}
+	for _, data := range []string{
+		`{"type":"binary","op":"+","x":{"type":"elem"},"y":{"type":"int","value":1}}`,
+		`{"type":"binary","op":"+","x":{"type":"local","name":"r"},"y":{"type":"int","value":1}}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &b); err == nil {
+			t.Errorf("%s decoded into %s", data, b)
+		}
+	}
+}
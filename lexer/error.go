@@ -0,0 +1,36 @@
+package lexer
+
+import (
+	"fmt"
+	"text/scanner"
+)
+
+// Position is a location in the input.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number, starting at 1 (character count per line)
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+func toPosition(p scanner.Position) Position {
+	return Position{Offset: p.Offset, Line: p.Line, Column: p.Column}
+}
+
+// Error is a lexical error, e.g. an unrecognized character or an
+// unterminated string literal.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos Position, format string, args ...interface{}) *Error {
+	return &Error{pos, fmt.Sprintf(format, args...)}
+}
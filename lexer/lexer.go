@@ -10,15 +10,22 @@ func Parse(input string) ([]Token, error) {
 
 	lex.scan.Init(strings.NewReader(input))
 	lex.scan.Mode = scanner.GoTokens
+	lex.scan.Error = lex.scanError
 
 	for lex.next(); lex.cur != scanner.EOF; lex.next() {
+		if lex.err != nil {
+			return nil, lex.err
+		}
 		err := state(lex)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if lex.err != nil {
+		return nil, lex.err
+	}
 
-	lex.emit(EOF)
+	lex.emitAt(EOF, "", toPosition(lex.scan.Pos()))
 
 	return lex.tokens, nil
 }
@@ -31,6 +38,7 @@ type Lexer struct {
 	tokens []Token
 	cur    rune // Scanner look ahead
 	scan   scanner.Scanner
+	err    error // first error reported by the scanner
 }
 
 func (lex *Lexer) next() { lex.cur = lex.scan.Scan() }
@@ -39,8 +47,28 @@ func (lex *Lexer) peek() rune { return lex.scan.Peek() }
 
 func (lex *Lexer) text() string { return lex.scan.TokenText() }
 
+func (lex *Lexer) pos() Position { return toPosition(lex.scan.Position) }
+
 func (lex *Lexer) accept(valid string) bool { return strings.ContainsRune(valid, lex.peek()) }
 
-func (lex *Lexer) emitWithVal(t Type, v string) { lex.tokens = append(lex.tokens, Token{t, v}) }
+func (lex *Lexer) emitAt(t Type, v string, pos Position) {
+	lex.tokens = append(lex.tokens, Token{t, v, pos, toPosition(lex.scan.Pos())})
+}
+
+func (lex *Lexer) emitWithVal(t Type, v string) { lex.emitAt(t, v, lex.pos()) }
 
 func (lex *Lexer) emit(t Type) { lex.emitWithVal(t, lex.text()) }
+
+func (lex *Lexer) errorf(format string, args ...interface{}) error {
+	return errorf(lex.pos(), format, args...)
+}
+
+func (lex *Lexer) scanError(s *scanner.Scanner, msg string) {
+	if lex.err == nil {
+		pos := s.Position
+		if !pos.IsValid() {
+			pos = s.Pos()
+		}
+		lex.err = errorf(toPosition(pos), "%s", msg)
+	}
+}
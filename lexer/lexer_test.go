@@ -13,97 +13,194 @@ var lexTests = []lexTest{
 	{
 		`2 < a || b < 9`,
 		[]Token{
-			{Int, "2"},
-			{Operator, "<"},
-			{Ident, "a"},
-			{Operator, "||"},
-			{Ident, "b"},
-			{Operator, "<"},
-			{Int, "9"},
-			{EOF, ""},
+			{tp: Int, val: "2"},
+			{tp: Operator, val: "<"},
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "||"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: "<"},
+			{tp: Int, val: "9"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`((a + 2) == 3) > 0`,
 		[]Token{
-			{Bracket, "("},
-			{Bracket, "("},
-			{Ident, "a"},
-			{Operator, "+"},
-			{Int, "2"},
-			{Bracket, ")"},
-			{Operator, "=="},
-			{Int, "3"},
-			{Bracket, ")"},
-			{Operator, ">"},
-			{Int, "0"},
-			{EOF, ""},
+			{tp: Bracket, val: "("},
+			{tp: Bracket, val: "("},
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "+"},
+			{tp: Int, val: "2"},
+			{tp: Bracket, val: ")"},
+			{tp: Operator, val: "=="},
+			{tp: Int, val: "3"},
+			{tp: Bracket, val: ")"},
+			{tp: Operator, val: ">"},
+			{tp: Int, val: "0"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`pow(x, 3) + pow(y, 3)`,
 		[]Token{
-			{Ident, "pow"},
-			{Bracket, "("},
-			{Ident, "x"},
-			{Operator, ","},
-			{Int, "3"},
-			{Bracket, ")"},
-			{Operator, "+"},
-			{Ident, "pow"},
-			{Bracket, "("},
-			{Ident, "y"},
-			{Operator, ","},
-			{Int, "3"},
-			{Bracket, ")"},
-			{EOF, ""},
+			{tp: Ident, val: "pow"},
+			{tp: Bracket, val: "("},
+			{tp: Ident, val: "x"},
+			{tp: Operator, val: ","},
+			{tp: Int, val: "3"},
+			{tp: Bracket, val: ")"},
+			{tp: Operator, val: "+"},
+			{tp: Ident, val: "pow"},
+			{tp: Bracket, val: "("},
+			{tp: Ident, val: "y"},
+			{tp: Operator, val: ","},
+			{tp: Int, val: "3"},
+			{tp: Bracket, val: ")"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`!(a > 0) || False`,
 		[]Token{
-			{Operator, "!"},
-			{Bracket, "("},
-			{Ident, "a"},
-			{Operator, ">"},
-			{Int, "0"},
-			{Bracket, ")"},
-			{Operator, "||"},
-			{Bool, "false"},
-			{EOF, ""},
+			{tp: Operator, val: "!"},
+			{tp: Bracket, val: "("},
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: ">"},
+			{tp: Int, val: "0"},
+			{tp: Bracket, val: ")"},
+			{tp: Operator, val: "||"},
+			{tp: Bool, val: "false"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`note == "hello, world"`,
 		[]Token{
-			{Ident, "note"},
-			{Operator, "=="},
-			{String, "hello, world"},
-			{EOF, ""},
+			{tp: Ident, val: "note"},
+			{tp: Operator, val: "=="},
+			{tp: String, val: "hello, world"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`grade >= 'a'`,
 		[]Token{
-			{Ident, "grade"},
-			{Operator, ">="},
-			{Char, "a"},
-			{EOF, ""},
+			{tp: Ident, val: "grade"},
+			{tp: Operator, val: ">="},
+			{tp: Char, val: "a"},
+			{tp: EOF, val: ""},
 		},
 	},
 
 	{
 		`a and b`,
 		[]Token{
-			{Ident, "a"},
-			{Operator, "&&"},
-			{Ident, "b"},
-			{EOF, ""},
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "&&"},
+			{tp: Ident, val: "b"},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		`a =~ "x" && b !~ c || d matches e`,
+		[]Token{
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "=~"},
+			{tp: String, val: "x"},
+			{tp: Operator, val: "&&"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: "!~"},
+			{tp: Ident, val: "c"},
+			{tp: Operator, val: "||"},
+			{tp: Ident, val: "d"},
+			{tp: Operator, val: "=~"},
+			{tp: Ident, val: "e"},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		"\"a\\\"b\\n\\u00e9\" + '\\'' + `c\\d\"`",
+		[]Token{
+			{tp: String, val: "a\"b\né"},
+			{tp: Operator, val: "+"},
+			{tp: Char, val: "'"},
+			{tp: Operator, val: "+"},
+			{tp: String, val: `c\d"`},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		`a ?? nil ? b?.c : NULL`,
+		[]Token{
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "??"},
+			{tp: Null, val: "null"},
+			{tp: Operator, val: "?"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: "?"},
+			{tp: Operator, val: "."},
+			{tp: Ident, val: "c"},
+			{tp: Operator, val: ":"},
+			{tp: Null, val: "null"},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		`a&^b<<c>>d ^ ^e|h&g`,
+		[]Token{
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "&^"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: "<<"},
+			{tp: Ident, val: "c"},
+			{tp: Operator, val: ">>"},
+			{tp: Ident, val: "d"},
+			{tp: Operator, val: "^"},
+			{tp: Operator, val: "^"},
+			{tp: Ident, val: "e"},
+			{tp: Operator, val: "|"},
+			{tp: Ident, val: "h"},
+			{tp: Operator, val: "&"},
+			{tp: Ident, val: "g"},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		`a**b*c`,
+		[]Token{
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "**"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: "*"},
+			{tp: Ident, val: "c"},
+			{tp: EOF, val: ""},
+		},
+	},
+
+	{
+		`let r = a / b; r > 0.3`,
+		[]Token{
+			{tp: Keyword, val: "let"},
+			{tp: Ident, val: "r"},
+			{tp: Operator, val: "="},
+			{tp: Ident, val: "a"},
+			{tp: Operator, val: "/"},
+			{tp: Ident, val: "b"},
+			{tp: Operator, val: ";"},
+			{tp: Ident, val: "r"},
+			{tp: Operator, val: ">"},
+			{tp: Float, val: "0.3"},
+			{tp: EOF, val: ""},
 		},
 	},
 }
@@ -135,3 +232,63 @@ func compareTokens(i1, i2 []Token) bool {
 	}
 	return true
 }
+
+func TestLexPositions(t *testing.T) {
+	tokens, err := Parse("a >= 10 &&\n  b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]Position{
+		{{0, 1, 1}, {1, 1, 2}},
+		{{2, 1, 3}, {4, 1, 5}},
+		{{5, 1, 6}, {7, 1, 8}},
+		{{8, 1, 9}, {10, 1, 11}},
+		{{13, 2, 3}, {14, 2, 4}},
+		{{14, 2, 4}, {14, 2, 4}},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if tok.Pos() != want[i][0] || tok.End() != want[i][1] {
+			t.Errorf("%v: got range %+v-%+v, want %+v-%+v",
+				tok, tok.Pos(), tok.End(), want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		pos   Position
+		msg   string
+	}{
+		{"a $ b", Position{2, 1, 3}, "unrecognized character: U+0024 '$'"},
+		{`x == "abc`, Position{5, 1, 6}, "literal not terminated"},
+		{`x == "a\qb"`, Position{5, 1, 6}, "invalid char escape"},
+		{`'\x4'`, Position{0, 1, 1}, "invalid char escape"},
+		{`"\ud800"`, Position{0, 1, 1}, `invalid escape sequence in literal "\ud800"`},
+	} {
+		_, err := Parse(test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: got error %v, want *Error", test.input, err)
+			continue
+		}
+		if e.Pos != test.pos || e.Msg != test.msg {
+			t.Errorf("%s: got %+v %q, want %+v %q", test.input, e.Pos, e.Msg, test.pos, test.msg)
+		}
+	}
+}
+
+func TestIsKeyword(t *testing.T) {
+	for _, s := range []string{"x", "true", "TRUE", "Null", "nil", "and", "MATCHES", "in", "not_in", "let", "Let", "_", "in2"} {
+		toks, err := Parse(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if want := toks[0].Type() != Ident; IsKeyword(s) != want {
+			t.Errorf("IsKeyword(%q) = %v, want %v", s, !want, want)
+		}
+	}
+}
@@ -1,8 +1,7 @@
 package lexer
 
 import (
-	"errors"
-	"fmt"
+	"strconv"
 	"strings"
 	"text/scanner"
 )
@@ -17,6 +16,33 @@ var str2op = map[string]string{
 	"lt":  "<",
 	"gt":  ">",
 	"not": "!",
+
+	"matches": "=~",
+}
+
+// word returns the type of the token the identifier s is read as: Ident,
+// or Bool, Null, Operator or Keyword for the words reserved by the lexer.
+func word(s string) Type {
+	switch s {
+	case "t", "T", "true", "True", "f", "F", "false", "False", "TRUE", "FALSE":
+		return Bool
+	case "null", "Null", "NULL", "nil":
+		return Null
+	case "and", "AND", "or", "OR", "not",
+		"le", "LE", "ge", "GE", "lt", "LT", "gt", "GT",
+		"eq", "EQ", "ne", "NE", "matches", "MATCHES",
+		"in", "not_in":
+		return Operator
+	case "let":
+		return Keyword
+	}
+	return Ident
+}
+
+// IsKeyword reports whether s is a word the lexer reserves, that is one it
+// doesn't read as an identifier.
+func IsKeyword(s string) bool {
+	return word(s) != Ident
 }
 
 func state(lex *Lexer) error {
@@ -27,24 +53,26 @@ func state(lex *Lexer) error {
 	case scanner.Float:
 		lex.emit(Float)
 	case scanner.Char:
-		lex.emitWithVal(Char, lex.text()[1:len(lex.text())-1])
-	case scanner.String:
-		lex.emitWithVal(String, lex.text()[1:len(lex.text())-1])
-	case scanner.RawString:
-		// ignore this for now
+		return lex.emitQuoted(Char)
+	case scanner.String, scanner.RawString:
+		return lex.emitQuoted(String)
 	case scanner.Comment:
 		// ignore this for now
 
 	case scanner.Ident:
-		switch lex.text() {
-		case "t", "T", "true", "True", "f", "F", "false", "False", "TRUE", "FALSE":
+		switch word(lex.text()) {
+		case Bool:
 			lex.emitWithVal(Bool, strings.ToLower(lex.text()))
-		case "and", "AND", "or", "OR", "not",
-			"le", "LE", "ge", "GE", "lt", "LT", "gt", "GT",
-			"eq", "EQ", "ne", "NE": // logic operator
-			lex.emitWithVal(Operator, str2op[strings.ToLower(lex.text())])
-		case "in", "not_in":
-			lex.emit(Operator)
+		case Null:
+			lex.emitWithVal(Null, "null")
+		case Operator:
+			if op, ok := str2op[strings.ToLower(lex.text())]; ok { // logic operator
+				lex.emitWithVal(Operator, op)
+			} else {
+				lex.emit(Operator)
+			}
+		case Keyword:
+			lex.emit(Keyword)
 		default:
 			lex.emit(Ident)
 		}
@@ -53,18 +81,35 @@ func state(lex *Lexer) error {
 		switch {
 		case strings.ContainsRune("{[()]}", lex.cur):
 			lex.emit(Bracket)
-		case strings.ContainsRune("#,?:%+-/", lex.cur): // single rune operator
+		case lex.cur == '?' && lex.accept("?"):
+			pos := lex.pos()
+			lex.next()
+			lex.emitAt(Operator, "??", pos)
+		case strings.ContainsRune("#,;?:%+-/.^", lex.cur): // single rune operator
 			lex.emit(Operator)
 		case strings.ContainsRune("&|!=*<>", lex.cur): // possible double rune operator
-			op := lex.text()
-			if lex.accept("&|=*") {
+			op, pos := lex.text(), lex.pos()
+			if lex.accept("&|=*") || strings.ContainsRune("=!", lex.cur) && lex.accept("~") ||
+				strings.ContainsRune("<>", lex.cur) && lex.accept(string(lex.cur)) || lex.cur == '&' && lex.accept("^") {
 				lex.next()
 				op += lex.text()
 			}
-			lex.emitWithVal(Operator, op)
+			lex.emitAt(Operator, op, pos)
 		default:
-			return errors.New(fmt.Sprintf("unrecognized character: %#U", lex.cur))
+			return lex.errorf("unrecognized character: %#U", lex.cur)
 		}
 	}
 	return nil
 }
+
+// emitQuoted emits the quoted literal just scanned, unquoted as in Go:
+// escape sequences are processed in 'c' and "s", and `raw` strings are
+// taken as they are, apart from carriage returns.
+func (lex *Lexer) emitQuoted(t Type) error {
+	s, err := strconv.Unquote(lex.text())
+	if err != nil {
+		return lex.errorf("invalid escape sequence in literal %s", lex.text())
+	}
+	lex.emitWithVal(t, s)
+	return nil
+}
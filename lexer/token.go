@@ -10,6 +10,8 @@ const (
 	Float         = "float"
 	Char          = "char"
 	Bool          = "bool"
+	Null          = "null"
+	Keyword       = "keyword"
 	String        = "String"
 	Operator      = "Operator"
 	Bracket       = "Bracket"
@@ -19,6 +21,8 @@ const (
 type Token struct {
 	tp  Type
 	val string
+	pos Position // start of the token
+	end Position // position immediately after the token
 }
 
 func (t Token) Value() string {
@@ -29,6 +33,14 @@ func (t Token) Type() Type {
 	return t.tp
 }
 
+func (t Token) Pos() Position {
+	return t.pos
+}
+
+func (t Token) End() Position {
+	return t.end
+}
+
 func (t Token) String() string {
 	if t.val == "" {
 		return string(t.tp)
@@ -0,0 +1,99 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestLimits(t *testing.T) {
+	env := parser.Env{"x": 1, "s": "abcd", "long": strings.Repeat("A", 20), "xs": []int{1, 2, 3}}
+	for _, test := range []struct {
+		expr   string
+		limits parser.Limits
+		limit  string // exceeded limit, if any
+		node   string // source text of the node that exceeded it
+	}{
+		{"x + 1 > 0", parser.Limits{MaxSteps: 10, MaxStringLen: 4, MaxArrayLen: 1, MaxDepth: 3}, "", ""},
+		{"x + x + x + x + x + x", parser.Limits{MaxSteps: 4}, "MaxSteps", ""},
+		{"s + s + s", parser.Limits{MaxStringLen: 10}, "MaxStringLen", "s + s + s"},
+		{"s + s", parser.Limits{MaxStringLen: 10}, "", ""},
+		{"len(lower(long)) > 0", parser.Limits{MaxStringLen: 10}, "MaxStringLen", "lower(long)"},
+		{"len(long) > 0", parser.Limits{MaxStringLen: 10}, "", ""},
+		{"x in [x, 2, 3, 4]", parser.Limits{MaxArrayLen: 3}, "MaxArrayLen", "[x, 2, 3, 4]"},
+		{`{"a": x, "b": 2}["a"] > 0`, parser.Limits{MaxArrayLen: 1}, "MaxArrayLen", `{"a": x, "b": 2}`},
+		{"len(map([1, 2, 3], # * x)) > 0", parser.Limits{MaxArrayLen: 3}, "", ""},
+		{"len(map([1, 2, 3, x], # * x)) > 0", parser.Limits{MaxArrayLen: 3}, "MaxArrayLen", "[1, 2, 3, x]"},
+		{"len(filter(xs, # > 0)) > 0", parser.Limits{MaxArrayLen: 2}, "MaxArrayLen", "filter(xs, # > 0)"},
+		{"any(xs, # > 5)", parser.Limits{MaxSteps: 4}, "MaxSteps", ""},
+		{"-(-(-(-x)))", parser.Limits{MaxDepth: 3}, "MaxDepth", "-x"},
+		{"-(-(-(-x)))", parser.Limits{MaxDepth: 5}, "", ""},
+		{"x + x + x + x + x + x", parser.Limits{}, "", ""},
+	} {
+		prog, err := Compile(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, treeErr := parser.EvalContext(context.Background(), prog.Node(), env, test.limits)
+		_, vmErr := prog.EvalContext(context.Background(), env, test.limits)
+		for _, err := range []error{treeErr, vmErr} {
+			var le *parser.LimitError
+			if test.limit == "" {
+				if err != nil {
+					t.Errorf("%s with %+v: unexpected error %v", test.expr, test.limits, err)
+				}
+				continue
+			}
+			if !errors.As(err, &le) || le.Limit != test.limit {
+				t.Errorf("%s with %+v: got error %v, want %s exceeded", test.expr, test.limits, err, test.limit)
+				continue
+			}
+			var e *parser.EvalError
+			errors.As(err, &e)
+			if test.node != "" {
+				span := e.Node.Span()
+				if got := test.expr[span.Start.Offset:span.End.Offset]; got != test.node {
+					t.Errorf("%s: error points at %s, want %s", test.expr, got, test.node)
+				}
+			}
+		}
+	}
+}
+
+func TestEvalContextCancel(t *testing.T) {
+	var cancel context.CancelFunc
+	fs := parser.Builtins()
+	fs.Register("stop", func() bool {
+		cancel()
+		return true
+	})
+	expr := "stop()" + strings.Repeat(" && x > 0", 1000)
+	prog, err := Compile(expr, parser.WithFunctions(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := parser.Env{"x": 1}
+	for _, eval := range []func(context.Context) (interface{}, error){
+		func(ctx context.Context) (interface{}, error) {
+			return parser.EvalContext(ctx, prog.Node(), env, parser.Limits{})
+		},
+		func(ctx context.Context) (interface{}, error) {
+			return prog.EvalContext(ctx, env, parser.Limits{})
+		},
+	} {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		if _, err := eval(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled while running: got error %v, want %v", err, context.Canceled)
+		}
+		// the context is done before the next run starts
+		if _, err := eval(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled before running: got error %v, want %v", err, context.Canceled)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,113 @@
+package eval
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestOptimize(t *testing.T) {
+	fs := parser.Builtins()
+	calls := 0
+	fs.Add(&parser.Function{
+		Name:   "next",
+		Params: []parser.Param{{Name: "x", Type: parser.IntType}},
+		Result: parser.IntType,
+		Call: func(args []interface{}) (interface{}, error) {
+			calls++
+			return args[0].(int64) + int64(calls), nil
+		},
+	})
+	for _, test := range []struct {
+		expr string
+		want string // disassembly
+	}{
+		{"1 + 2 * 3", "0000 const         7\n"},
+		{"-(1.5 * 2) > -4", "0000 const         true\n"},
+		{`lower("ABC") + x`, "0000 const         \"abc\"\n0001 load          x\n0002 add\n"},
+		{`len("abc") == 3 && has_prefix("abc", "a")`, "0000 const         true\n"},
+		{"pow(2, 10) + sqrt(x)", "0000 const         1024\n0001 load          x\n0002 call          sqrt/1\n0003 add\n"},
+		{"false && x > 1", "0000 const         false\n"},
+		{"1 < 2 || x", "0000 const         true\n"},
+		{"true ? a : b", "0000 load          a\n"},
+		{"1 > 2 ? a : b", "0000 load          b\n"},
+		{`x in ["a", "b"]`, "0000 load          x\n0001 const         set{\"a\", \"b\"}\n0002 in\n"},
+		{`x not_in [1 + 1, "c"]`, "0000 load          x\n0001 const         set{2, \"c\"}\n0002 not_in\n"},
+		{`x in ["a", y]`, "0000 load          x\n0001 const         \"a\"\n0002 load          y\n0003 array         2\n0004 in\n"},
+		{"next(1)", "0000 const         1\n0001 call          next/1\n"},
+		{"1 / 0", "0000 const         1\n0001 const         0\n0002 div\n"},
+		{`"a" - 1`, "0000 const         \"a\"\n0001 const         1\n0002 sub\n"},
+		{"[1 + 1, 2]", "0000 const         2\n0001 const         2\n0002 array         2\n"},
+		{"1 << 10 | ^-4", "0000 const         1027\n"},
+		{"2 ** 3 ** 2 * 2", "0000 const         1024\n"},
+		{"let lo = 0.5; x > lo", "0000 load          x\n0001 const         0.5\n0002 gt\n"},
+		{"let n = next(1); n + n", "0000 let           1\n0001 jump          5\n0002 const         1\n0003 call          next/1\n0004 bind\n0005 local         0\n0006 local         0\n0007 add\n0008 unbind        1\n"},
+	} {
+		node, err := Parse(test.expr, parser.WithFunctions(fs))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		// a folded constant spans what it was folded from
+		folded := strings.Count(test.want, "\n") == 1 && strings.HasPrefix(test.want, "0000 const")
+		if span := node.Span(); folded && (span.Start.Offset != 0 || span.End.Offset != len(test.expr)) {
+			t.Errorf("%s: optimized node spans %v, want the whole input", test.expr, span)
+		}
+		prog, err := parser.Compile(node)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := prog.String(); got != test.want {
+			t.Errorf("%s compiles to\n%s\nwant\n%s", test.expr, got, test.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("impure function was called %d times while parsing", calls)
+	}
+}
+
+func TestSets(t *testing.T) {
+	node, err := Parse(`x in [1, 2.5, "a", true, 1e20]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eq, err := Parse("x == y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a set holds what == finds in the list
+	list := []interface{}{int64(1), 2.5, "a", true, 1e20}
+	for _, x := range []interface{}{
+		1, int8(1), uint64(1), 1.0, float32(1), int64(2), 2.5, float32(2.5), 2.4,
+		"a", "A", "1", true, false, 1e20, nil, []interface{}{1}, map[string]interface{}{},
+	} {
+		want := false
+		for _, y := range list {
+			if v, _ := parser.EvalE(eq, parser.Env{"x": x, "y": y}); v == true {
+				want = true
+			}
+		}
+		if got, err := parser.EvalE(node, parser.Env{"x": x}); got != want || err != nil {
+			t.Errorf("%#v in set = %v, %v, want %v", x, got, err, want)
+		}
+	}
+}
+
+func BenchmarkBlocklist(b *testing.B) {
+	words := make([]string, 5000)
+	for i := range words {
+		words[i] = strconv.Quote("user" + strconv.Itoa(i))
+	}
+	prog, err := Compile("name not_in [" + strings.Join(words, ", ") + "]")
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := parser.Env{"name": "user4999"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prog.Run(env)
+	}
+}
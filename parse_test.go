@@ -0,0 +1,149 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr     string
+		offset   int
+		line     int
+		column   int
+		token    string
+		expected []string
+		snippet  string
+	}{
+		{"a > > 3", 4, 1, 5, ">", []string{"identifier", "number", "bool", "string", "null", `"("`, `"["`, `"{"`, `"+"`, `"-"`, `"!"`, `"^"`},
+			"a > > 3\n    ^"},
+		{"g(a b)", 4, 1, 5, "b", []string{`")"`, `","`, "operator"},
+			"g(a b)\n    ^"},
+		{"(a + 1", 6, 1, 7, "", []string{`")"`, "operator"},
+			"(a + 1\n      ^"},
+		{"a b", 2, 1, 3, "b", []string{"operator", "end of file"},
+			"a b\n  ^"},
+		{"1 +\n\t* 2", 5, 2, 2, "*", []string{"identifier", "number", "bool", "string", "null", `"("`, `"["`, `"{"`, `"+"`, `"-"`, `"!"`, `"^"`},
+			"\t* 2\n\t^"},
+		{"user.", 5, 1, 6, "", []string{"identifier"},
+			"user.\n     ^"},
+		{"tags[0", 6, 1, 7, "", []string{`"]"`, "operator"},
+			"tags[0\n      ^"},
+		{`{"a": 1, "b": 2, "a": 3}`, 17, 1, 18, "a", nil,
+			`{"a": 1, "b": 2, "a": 3}` + "\n                 ^"},
+		{`{2: "a", 2.0: "b"}`, 9, 1, 10, "2.0", nil,
+			`{2: "a", 2.0: "b"}` + "\n         ^"},
+		{`{"a" 1}`, 5, 1, 6, "1", []string{`":"`, "operator"},
+			`{"a" 1}` + "\n     ^"},
+		{"a ? 1", 5, 1, 6, "", []string{`":"`, "operator"},
+			"a ? 1\n     ^"},
+		{"a $ b", 2, 1, 3, "", nil,
+			"a $ b\n  ^"},
+		{`a == "\d"`, 5, 1, 6, "", nil,
+			`a == "\d"` + "\n     ^"},
+		{"log(10)", 0, 1, 1, "log", nil,
+			"log(10)\n^"},
+		{"a + pow(1)", 4, 1, 5, "pow", nil,
+			"a + pow(1)\n    ^"},
+		{`sqrt("x")`, 5, 1, 6, "x", []string{"float"},
+			`sqrt("x")` + "\n     ^"},
+		{"len(1 + 2)", 4, 1, 5, "1", nil,
+			"len(1 + 2)\n    ^"},
+		{"default(a + 1, 0)", 8, 1, 9, "a", []string{"variable"},
+			"default(a + 1, 0)\n        ^"},
+		{`s =~ "(a"`, 5, 1, 6, "(a", nil,
+			`s =~ "(a"` + "\n     ^"},
+		{`regex_replace(s, "a)", "")`, 17, 1, 18, "a)", nil,
+			`regex_replace(s, "a)", "")` + "\n                 ^"},
+		{"# > 1", 0, 1, 1, "#", nil,
+			"# > 1\n^"},
+		{"any(#, # > 1)", 4, 1, 5, "#", nil,
+			"any(#, # > 1)\n    ^"},
+		{"any(xs, 1)", 8, 1, 9, "1", []string{"bool"},
+			"any(xs, 1)\n        ^"},
+		{"let r = r + 1; r", 8, 1, 9, "r", nil,
+			"let r = r + 1; r\n        ^"},
+		{"let r = 1; let r = 2; r", 15, 1, 16, "r", nil,
+			"let r = 1; let r = 2; r\n               ^"},
+		{"let 1 = 2; 1", 4, 1, 5, "1", []string{"identifier"},
+			"let 1 = 2; 1\n    ^"},
+		{"let r 1; r", 6, 1, 7, "1", []string{`"="`},
+			"let r 1; r\n      ^"},
+		{"let r = 1 r", 10, 1, 11, "r", []string{`";"`, "operator"},
+			"let r = 1 r\n          ^"},
+		{"1 + let r = 1; r", 4, 1, 5, "let", []string{"identifier", "number", "bool", "string", "null", `"("`, `"["`, `"{"`, `"+"`, `"-"`, `"!"`, `"^"`},
+			"1 + let r = 1; r\n    ^"},
+		{`1 "+" 2`, 2, 1, 3, "+", []string{"operator", "end of file"},
+			`1 "+" 2` + "\n  ^"},
+		{`lower("x" "," "y")`, 10, 1, 11, ",", []string{`")"`, `","`, "operator"},
+			`lower("x" "," "y")` + "\n          ^"},
+		{`[1 "]"`, 3, 1, 4, "]", []string{`"]"`, `","`, "operator"},
+			`[1 "]"` + "\n   ^"},
+		{`len "(" 1`, 4, 1, 5, "(", []string{"operator", "end of file"},
+			`len "(" 1` + "\n    ^"},
+	} {
+		_, err := Parse(test.expr)
+		var e *parser.ParseError
+		if !errors.As(err, &e) {
+			t.Errorf("%q: got error %v, want *parser.ParseError", test.expr, err)
+			continue
+		}
+		if e.Pos.Offset != test.offset || e.Pos.Line != test.line || e.Pos.Column != test.column {
+			t.Errorf("%q: got position %d (%d:%d), want %d (%d:%d)", test.expr,
+				e.Pos.Offset, e.Pos.Line, e.Pos.Column, test.offset, test.line, test.column)
+		}
+		if e.Token.Value() != test.token {
+			t.Errorf("%q: got token %v, want %q", test.expr, e.Token, test.token)
+		}
+		if !reflect.DeepEqual(e.Expected, test.expected) {
+			t.Errorf("%q: got expected set %q, want %q", test.expr, e.Expected, test.expected)
+		}
+		if got := e.Snippet(); got != test.snippet {
+			t.Errorf("%q: got snippet\n%s\nwant\n%s", test.expr, got, test.snippet)
+		}
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := Parse("(a + 1")
+	want := `1:7: unexpected end of file, expected one of ")", operator`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		env  parser.Env
+		want string // source text of the node that failed
+	}{
+		{"1 + (a && b)", parser.Env{"a": true, "b": 2}, "a && b"},
+		{"x > 0 && -name < 3", parser.Env{"x": 1, "name": "Tom"}, "-name"},
+		{"[1, 2] == [1, sqrt(s)]", parser.Env{"s": "4"}, "sqrt(s)"},
+		{"(a + b) * c > 1", parser.Env{"a": 1, "b": 2, "c": "3"}, "(a + b) * c"},
+		{"ok ||\n  lower(x)", parser.Env{"ok": false, "x": 1}, "lower(x)"},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if span := node.Span(); span.Start.Offset != 0 || span.End.Offset != len(test.expr) {
+			t.Errorf("%q: root spans %v, want the whole input", test.expr, span)
+		}
+		_, err = parser.EvalE(node, test.env)
+		var e *parser.EvalError
+		if !errors.As(err, &e) {
+			t.Errorf("%q: got error %v, want *parser.EvalError", test.expr, err)
+			continue
+		}
+		span := e.Node.Span()
+		if got := test.expr[span.Start.Offset:span.End.Offset]; got != test.want {
+			t.Errorf("%q: error points at %q (%v), want %q", test.expr, got, span, test.want)
+		}
+	}
+}
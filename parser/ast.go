@@ -1,44 +1,274 @@
 package parser
 
+import (
+	"fmt"
+	"github.com/Cauchy-NY/eval/lexer"
+)
+
 type Node interface {
-	Eval(env Env) interface{}
+	Eval(env Resolver) interface{}
+	// Span returns the source range the node was parsed from.
+	Span() Span
+}
+
+// Span is a range of the input, from the first character of a node up
+// to, but not including, End.
+type Span struct {
+	Start, End lexer.Position
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
 }
 
 type IdentNode struct {
-	val string
+	val  string
+	span Span
 }
 
 type IntNode struct {
-	val int64
+	val  int64
+	span Span
 }
 
 type FloatNode struct {
-	val float64
+	val  float64
+	span Span
 }
 
 type BoolNode struct {
-	val bool
+	val  bool
+	span Span
 }
 
 type StringNode struct {
-	val string
+	val  string
+	span Span
+}
+
+// NullNode is the literal null, or nil, the value of missing variables,
+// fields and keys.
+type NullNode struct {
+	span Span
+}
+
+// ElemNode is #, the element a predicate of all, any, none, filter, map
+// or count is applied to.
+type ElemNode struct {
+	span Span
+}
+
+// LetNode is let name = value; body, where name refers to value. The value
+// is evaluated when body first uses it, and at most once.
+type LetNode struct {
+	name        string
+	value, body Node
+	span        Span
+}
+
+// LocalNode is a reference to the value bound to name by an enclosing let.
+type LocalNode struct {
+	name string
+	span Span
 }
 
 type UnaryNode struct {
-	op string
-	x  Node
+	op   string
+	x    Node
+	span Span
 }
 
 type BinaryNode struct {
 	op   string
 	x, y Node
+	span Span
+}
+
+type CondNode struct {
+	cond, x, y Node
+	span       Span
 }
 
 type ArrayNode struct {
 	args []Node
+	span Span
+}
+
+type MapNode struct {
+	keys, vals []Node
+	span       Span
 }
 
 type FuncNode struct {
 	fn   string
 	args []Node
+	f    *Function // resolved by the parser
+	span Span
+}
+
+// MemberNode is x.name, or x?.name if optional: then a nil x yields nil
+// instead of failing.
+type MemberNode struct {
+	x        Node
+	name     string
+	optional bool
+	span     Span
+}
+
+// IndexNode is x[index], or x?.[index] if optional.
+type IndexNode struct {
+	x, index Node
+	optional bool
+	span     Span
+}
+
+// SetNode is an array literal of constants on the right of in or not_in,
+// hashed by Optimize.
+type SetNode struct {
+	elems []Node
+	set   *set
+	span  Span
+}
+
+func (n IdentNode) Span() Span  { return n.span }
+func (n IntNode) Span() Span    { return n.span }
+func (n FloatNode) Span() Span  { return n.span }
+func (n BoolNode) Span() Span   { return n.span }
+func (n StringNode) Span() Span { return n.span }
+func (n NullNode) Span() Span   { return n.span }
+func (n ElemNode) Span() Span   { return n.span }
+func (n LetNode) Span() Span    { return n.span }
+func (n LocalNode) Span() Span  { return n.span }
+func (n UnaryNode) Span() Span  { return n.span }
+func (n BinaryNode) Span() Span { return n.span }
+func (n CondNode) Span() Span   { return n.span }
+func (n ArrayNode) Span() Span  { return n.span }
+func (n MapNode) Span() Span    { return n.span }
+func (n FuncNode) Span() Span   { return n.span }
+func (n MemberNode) Span() Span { return n.span }
+func (n IndexNode) Span() Span  { return n.span }
+func (n SetNode) Span() Span    { return n.span }
+
+func (n IdentNode) String() string  { return Format(n) }
+func (n IntNode) String() string    { return Format(n) }
+func (n FloatNode) String() string  { return Format(n) }
+func (n BoolNode) String() string   { return Format(n) }
+func (n StringNode) String() string { return Format(n) }
+func (n NullNode) String() string   { return Format(n) }
+func (n ElemNode) String() string   { return Format(n) }
+func (n LetNode) String() string    { return Format(n) }
+func (n LocalNode) String() string  { return Format(n) }
+func (n UnaryNode) String() string  { return Format(n) }
+func (n BinaryNode) String() string { return Format(n) }
+func (n CondNode) String() string   { return Format(n) }
+func (n ArrayNode) String() string  { return Format(n) }
+func (n MapNode) String() string    { return Format(n) }
+func (n FuncNode) String() string   { return Format(n) }
+func (n MemberNode) String() string { return Format(n) }
+func (n IndexNode) String() string  { return Format(n) }
+func (n SetNode) String() string    { return Format(n) }
+
+// Constructors build nodes with an empty span. They don't validate their
+// operands: operators must be in symbolic form, as Format writes them, and
+// Check or Compile report trees that don't make sense.
+
+func NewIdent(name string) IdentNode       { return IdentNode{val: name} }
+func NewInt(v int64) IntNode               { return IntNode{val: v} }
+func NewFloat(v float64) FloatNode         { return FloatNode{val: v} }
+func NewBool(v bool) BoolNode              { return BoolNode{val: v} }
+func NewString(v string) StringNode        { return StringNode{val: v} }
+func NewNull() NullNode                    { return NullNode{} }
+func NewElem() ElemNode                    { return ElemNode{} }
+func NewLocal(name string) LocalNode       { return LocalNode{name: name} }
+func NewUnary(op string, x Node) UnaryNode { return UnaryNode{op: op, x: x} }
+
+// NewLet returns let name = value; body. References to the binding in
+// body are made with NewLocal.
+func NewLet(name string, value, body Node) LetNode {
+	return LetNode{name: name, value: value, body: body}
+}
+
+func NewBinary(op string, x, y Node) BinaryNode {
+	return BinaryNode{op: op, x: x, y: y}
+}
+
+func NewCond(cond, x, y Node) CondNode {
+	return CondNode{cond: cond, x: x, y: y}
+}
+
+func NewArray(elems ...Node) ArrayNode {
+	return ArrayNode{args: elems}
+}
+
+// NewMap returns the map literal whose entries are keys[i]: vals[i]. It
+// panics if keys and vals differ in length.
+func NewMap(keys, vals []Node) MapNode {
+	if len(keys) != len(vals) {
+		panic("parser: NewMap: keys and values differ in length")
+	}
+	return MapNode{keys: keys, vals: vals}
+}
+
+// NewCall returns a call of f, which is usually taken from Builtins or
+// the set given to WithFunctions.
+func NewCall(f *Function, args ...Node) FuncNode {
+	return FuncNode{fn: f.Name, args: args, f: f}
+}
+
+func NewMember(x Node, name string) MemberNode {
+	return MemberNode{x: x, name: name}
+}
+
+// NewOptionalMember returns x?.name.
+func NewOptionalMember(x Node, name string) MemberNode {
+	return MemberNode{x: x, name: name, optional: true}
+}
+
+func NewIndex(x, index Node) IndexNode {
+	return IndexNode{x: x, index: index}
+}
+
+// NewOptionalIndex returns x?.[index].
+func NewOptionalIndex(x, index Node) IndexNode {
+	return IndexNode{x: x, index: index, optional: true}
+}
+
+// Accessors return the parts of a node. The slices they return are
+// copies.
+
+func (n IdentNode) Name() string    { return n.val }
+func (n IntNode) Value() int64      { return n.val }
+func (n FloatNode) Value() float64  { return n.val }
+func (n BoolNode) Value() bool      { return n.val }
+func (n StringNode) Value() string  { return n.val }
+func (n UnaryNode) Op() string      { return n.op }
+func (n UnaryNode) X() Node         { return n.x }
+func (n BinaryNode) Op() string     { return n.op }
+func (n BinaryNode) X() Node        { return n.x }
+func (n BinaryNode) Y() Node        { return n.y }
+func (n CondNode) Cond() Node       { return n.cond }
+func (n CondNode) X() Node          { return n.x }
+func (n CondNode) Y() Node          { return n.y }
+func (n LetNode) Name() string      { return n.name }
+func (n LetNode) Value() Node       { return n.value }
+func (n LetNode) Body() Node        { return n.body }
+func (n LocalNode) Name() string    { return n.name }
+func (n ArrayNode) Elems() []Node   { return clone(n.args) }
+func (n MapNode) Keys() []Node      { return clone(n.keys) }
+func (n MapNode) Values() []Node    { return clone(n.vals) }
+func (n FuncNode) Name() string     { return n.fn }
+func (n FuncNode) Args() []Node     { return clone(n.args) }
+func (n MemberNode) X() Node        { return n.x }
+func (n MemberNode) Name() string   { return n.name }
+func (n MemberNode) Optional() bool { return n.optional }
+func (n IndexNode) X() Node         { return n.x }
+func (n IndexNode) Index() Node     { return n.index }
+func (n IndexNode) Optional() bool  { return n.optional }
+func (n SetNode) Elems() []Node     { return clone(n.elems) }
+
+// Function returns the function n calls, or nil if it wasn't resolved.
+func (n FuncNode) Function() *Function { return n.f }
+
+func clone(nodes []Node) []Node {
+	return append([]Node(nil), nodes...)
 }
@@ -3,170 +3,200 @@ package parser
 import (
 	"fmt"
 	"math"
-	"reflect"
+	"regexp"
 	"strings"
 )
 
-func (n BinaryNode) notInArray(env Env) interface{} {
-	want := n.x.Eval(env)
-	if list, ok := n.y.Eval(env).([]interface{}); ok {
-		for _, v := range list {
-			if reflect.DeepEqual(want, v) {
-				return false
-			}
-		}
-	}
-	return true
+var builtins = Functions{
+	"pow":        {Name: "pow", Params: []Param{{Name: "x", Type: FloatType}, {Name: "y", Type: FloatType}}, Result: FloatType, Call: pow, Pure: true},
+	"sin":        {Name: "sin", Params: []Param{{Name: "x", Type: FloatType}}, Result: FloatType, Call: sin, Pure: true},
+	"sqrt":       {Name: "sqrt", Params: []Param{{Name: "x", Type: FloatType}}, Result: FloatType, Call: sqrt, Pure: true},
+	"len":        {Name: "len", Params: []Param{{Name: "v", Type: AnyType, check: sized}}, Result: IntType, Call: length, Pure: true},
+	"lower":      {Name: "lower", Params: []Param{{Name: "s", Type: StringType}}, Result: StringType, Call: lower, Pure: true},
+	"str_index":  {Name: "str_index", Params: twoStringParams, Result: IntType, Call: strIndex, Pure: true},
+	"contains":   {Name: "contains", Params: twoStringParams, Result: BoolType, Call: contains, Pure: true},
+	"has_prefix": {Name: "has_prefix", Params: twoStringParams, Result: BoolType, Call: hasPrefix, Pure: true},
+	"has_suffix": {Name: "has_suffix", Params: twoStringParams, Result: BoolType, Call: hasSuffix, Pure: true},
+	"regex_extract": {Name: "regex_extract", Params: []Param{{Name: "s", Type: StringType}, {Name: "pattern", Type: StringType, pattern: true},
+		{Name: "group", Type: IntType, Optional: true}}, Result: StringType, Call: regexExtract, Pure: true},
+	"regex_replace": {Name: "regex_replace", Params: []Param{{Name: "s", Type: StringType}, {Name: "pattern", Type: StringType, pattern: true},
+		{Name: "repl", Type: StringType}}, Result: StringType, Call: regexReplace, Pure: true},
+	"defined": {Name: "defined", Params: []Param{{Name: "x", Type: AnyType}}, Result: BoolType, Call: defined, form: definedForm},
+	"default": {Name: "default", Params: []Param{{Name: "x", Type: AnyType}, {Name: "fallback", Type: AnyType}}, Result: AnyType, Call: fallback, form: defaultForm},
+	"all":     {Name: "all", Params: predicateParams, Result: BoolType, Call: lambdaCall, form: allForm},
+	"any":     {Name: "any", Params: predicateParams, Result: BoolType, Call: lambdaCall, form: anyForm},
+	"none":    {Name: "none", Params: predicateParams, Result: BoolType, Call: lambdaCall, form: noneForm},
+	"count":   {Name: "count", Params: predicateParams, Result: IntType, Call: lambdaCall, form: countForm},
+	"filter":  {Name: "filter", Params: predicateParams, Result: ArrayOf(AnyType), Call: lambdaCall, form: filterForm},
+	"map": {Name: "map", Params: []Param{{Name: "array", Type: ArrayOf(AnyType)}, {Name: "f", Type: AnyType}},
+		Result: ArrayOf(AnyType), Call: lambdaCall, form: mapForm},
 }
 
-func (n BinaryNode) inArray(env Env) interface{} {
-	want := n.x.Eval(env)
-	if list, ok := n.y.Eval(env).([]interface{}); ok {
-		for _, v := range list {
-			if reflect.DeepEqual(want, v) {
-				return true
-			}
-		}
-	}
-	return false
-}
+var predicateParams = []Param{{Name: "array", Type: ArrayOf(AnyType)}, {Name: "pred", Type: BoolType}}
 
-func (n FuncNode) pow(env Env) interface{} {
-	n.argsCheck(2)
+var twoStringParams = []Param{{Name: "s", Type: StringType}, {Name: "substr", Type: StringType}}
 
-	a := n.args[0].Eval(env)
-	b := n.args[1].Eval(env)
+// sized reports whether values of type t may have a length.
+func sized(t *Type) bool {
+	return t.Kind == Any || t.Kind == String || t.Kind == Array || t.Kind == Map
+}
 
-	x, ok := num2float64(a)
+func pow(args []interface{}) (interface{}, error) {
+	x, ok := num2float64(args[0])
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return nil, argError("pow", args...)
 	}
-	y, ok := num2float64(b)
+	y, ok := num2float64(args[1])
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return nil, argError("pow", args...)
 	}
-
-	return math.Pow(x, y)
+	return math.Pow(x, y), nil
 }
 
-func (n FuncNode) sin(env Env) interface{} {
-	n.argsCheck(1)
-	a := n.args[0].Eval(env)
-	x, ok := num2float64(a)
+func sin(args []interface{}) (interface{}, error) {
+	x, ok := num2float64(args[0])
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T)", n.fn, a))
+		return nil, argError("sin", args...)
 	}
-	return math.Sin(x)
+	return math.Sin(x), nil
 }
 
-func (n FuncNode) sqrt(env Env) interface{} {
-	n.argsCheck(1)
-	a := n.args[0].Eval(env)
-	x, ok := num2float64(a)
+func sqrt(args []interface{}) (interface{}, error) {
+	x, ok := num2float64(args[0])
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T)", n.fn, a))
+		return nil, argError("sqrt", args...)
 	}
-	return math.Sqrt(x)
+	return math.Sqrt(x), nil
 }
 
-func (n FuncNode) len(env Env) interface{} {
-	n.argsCheck(1)
-	a := n.args[0].Eval(env)
-	x, ok := a.(string)
+func length(args []interface{}) (interface{}, error) {
+	x, ok := lengthOf(args[0])
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T)", n.fn, a))
+		return nil, argError("len", args...)
 	}
-	return int64(len(x))
+	return x, nil
 }
 
-func (n FuncNode) lower(env Env) interface{} {
-	n.argsCheck(1)
-	a := n.args[0].Eval(env)
-	x, ok := a.(string)
+func lower(args []interface{}) (interface{}, error) {
+	x, ok := args[0].(string)
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T)", n.fn, a))
+		return nil, argError("lower", args...)
 	}
-	return strings.ToLower(x)
+	return strings.ToLower(x), nil
 }
 
-func (n FuncNode) index(env Env) interface{} {
-	n.argsCheck(2)
-
-	a := n.args[0].Eval(env)
-	b := n.args[1].Eval(env)
-
-	x, ok := a.(string)
+// twoStrings returns both arguments of fn, which must be strings.
+func twoStrings(fn string, args []interface{}) (string, string, error) {
+	x, ok := args[0].(string)
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return "", "", argError(fn, args...)
 	}
-	y, ok := b.(string)
+	y, ok := args[1].(string)
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return "", "", argError(fn, args...)
 	}
-
-	return int64(strings.Index(x, y))
+	return x, y, nil
 }
 
-func (n FuncNode) contains(env Env) interface{} {
-	n.argsCheck(2)
-
-	a := n.args[0].Eval(env)
-	b := n.args[1].Eval(env)
-
-	x, ok := a.(string)
-	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
-	}
-	y, ok := b.(string)
-	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+func strIndex(args []interface{}) (interface{}, error) {
+	x, y, err := twoStrings("str_index", args)
+	if err != nil {
+		return nil, err
 	}
+	return int64(strings.Index(x, y)), nil
+}
 
-	return strings.Contains(x, y)
+func contains(args []interface{}) (interface{}, error) {
+	x, y, err := twoStrings("contains", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Contains(x, y), nil
 }
 
-func (n FuncNode) hasPrefix(env Env) interface{} {
-	n.argsCheck(2)
+func hasPrefix(args []interface{}) (interface{}, error) {
+	x, y, err := twoStrings("has_prefix", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(x, y), nil
+}
 
-	a := n.args[0].Eval(env)
-	b := n.args[1].Eval(env)
+func hasSuffix(args []interface{}) (interface{}, error) {
+	x, y, err := twoStrings("has_suffix", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(x, y), nil
+}
 
-	x, ok := a.(string)
+// stringAndPattern returns the string and the regular expression that are
+// the first two arguments of fn.
+func stringAndPattern(fn string, args []interface{}) (string, *regexp.Regexp, error) {
+	s, ok := args[0].(string)
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return "", nil, argError(fn, args...)
 	}
-	y, ok := b.(string)
-	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+	re, err := pattern(args[1])
+	if err != nil {
+		return "", nil, err
 	}
-
-	return strings.HasPrefix(x, y)
+	if re == nil {
+		return "", nil, argError(fn, args...)
+	}
+	return s, re, nil
 }
 
-func (n FuncNode) hasSuffix(env Env) interface{} {
-	n.argsCheck(2)
-
-	a := n.args[0].Eval(env)
-	b := n.args[1].Eval(env)
+// regexExtract returns the text of the given group, the whole match by
+// default, of the first match of the pattern in s, or "" if there is none.
+func regexExtract(args []interface{}) (interface{}, error) {
+	s, re, err := stringAndPattern("regex_extract", args)
+	if err != nil {
+		return nil, err
+	}
+	var group int64
+	if len(args) > 2 {
+		g, ok := toInt(args[2])
+		if !ok {
+			return nil, argError("regex_extract", args...)
+		}
+		group = g
+	}
+	if group < 0 || group > int64(re.NumSubexp()) {
+		return nil, fmt.Errorf("regex_extract: no group %d in %s", group, re)
+	}
+	m := re.FindStringSubmatchIndex(s)
+	if m == nil || m[2*group] < 0 {
+		return "", nil
+	}
+	return s[m[2*group]:m[2*group+1]], nil
+}
 
-	x, ok := a.(string)
-	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+// regexReplace replaces the matches of the pattern in s by repl, in which
+// $1 or ${name} stand for the text of a group.
+func regexReplace(args []interface{}) (interface{}, error) {
+	s, re, err := stringAndPattern("regex_replace", args)
+	if err != nil {
+		return nil, err
 	}
-	y, ok := b.(string)
+	repl, ok := args[2].(string)
 	if !ok {
-		panic(fmt.Sprintf("invalid arguments: %v(%T, %T)", n.fn, a, b))
+		return nil, argError("regex_replace", args...)
 	}
-
-	return strings.HasSuffix(x, y)
+	return re.ReplaceAllString(s, repl), nil
 }
 
-func (n FuncNode) argsCheck(num int) {
-	if len(n.args) < num {
-		panic(fmt.Sprintf("not enough arguments in call to: %s : ", n.fn))
-	}
+// defined and fallback are the plain versions of defined and default, for
+// arguments that have already been evaluated; calls from expressions probe
+// their first argument instead, see probe.
+
+func defined(args []interface{}) (interface{}, error) {
+	return args[0] != nil, nil
+}
 
-	if len(n.args) > num {
-		panic(fmt.Sprintf("too many arguments in call to: %s : ", n.fn))
+func fallback(args []interface{}) (interface{}, error) {
+	if args[0] != nil {
+		return args[0], nil
 	}
+	return args[1], nil
 }
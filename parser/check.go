@@ -0,0 +1,441 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of a static type.
+type Kind int
+
+const (
+	Any Kind = iota // unknown until run time
+	Bool
+	Int
+	Float
+	String
+	Array
+	Map
+)
+
+// Type is the static type of an expression.
+type Type struct {
+	Kind Kind
+	Elem *Type // element type of arrays and maps
+}
+
+var (
+	AnyType    = &Type{Kind: Any}
+	BoolType   = &Type{Kind: Bool}
+	IntType    = &Type{Kind: Int}
+	FloatType  = &Type{Kind: Float}
+	StringType = &Type{Kind: String}
+)
+
+// ArrayOf returns the type of arrays of elem.
+func ArrayOf(elem *Type) *Type {
+	return &Type{Kind: Array, Elem: elem}
+}
+
+// MapOf returns the type of maps with values of type elem.
+func MapOf(elem *Type) *Type {
+	return &Type{Kind: Map, Elem: elem}
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case Bool:
+		return "bool"
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case String:
+		return "string"
+	case Array:
+		return "[]" + t.Elem.String()
+	case Map:
+		return "map[" + t.Elem.String() + "]"
+	}
+	return "any"
+}
+
+func (t *Type) numeric() bool {
+	return t.Kind == Int || t.Kind == Float
+}
+
+// identical reports whether t and u are the same type.
+func identical(t, u *Type) bool {
+	if t.Kind != u.Kind {
+		return false
+	}
+	if t.Kind == Array || t.Kind == Map {
+		return identical(t.Elem, u.Elem)
+	}
+	return true
+}
+
+// assignable reports whether a value of type t may be used where u is
+// expected. Any goes both ways, and an int is accepted for a float.
+func assignable(t, u *Type) bool {
+	switch {
+	case t.Kind == Any || u.Kind == Any:
+		return true
+	case t.Kind == Int && u.Kind == Float:
+		return true
+	case t.Kind != u.Kind:
+		return false
+	case t.Kind == Array || t.Kind == Map:
+		return assignable(t.Elem, u.Elem)
+	}
+	return true
+}
+
+// join returns the type of a value that is either of type t or of type u.
+func join(t, u *Type) *Type {
+	if identical(t, u) {
+		return t
+	}
+	return AnyType
+}
+
+// Schema declares the types of the variables of an expression.
+type Schema map[string]*Type
+
+// TypeError reports an expression that is certain to fail, or to be
+// meaningless, for the variable types of a schema.
+type TypeError struct {
+	Node Node
+	Msg  string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Node.Span().Start, e.Msg)
+}
+
+// TypeErrors is the list of errors found by Check.
+type TypeErrors []*TypeError
+
+func (errs TypeErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Check infers the type of node for variables of the types declared in
+// schema, and returns it. It reports mismatched operands, unknown variables
+// and functions and calls with the wrong number of arguments as TypeErrors.
+func Check(node Node, schema Schema) (*Type, error) {
+	c := &checker{schema: schema}
+	t := c.check(node)
+	if len(c.errs) > 0 {
+		return t, c.errs
+	}
+	return t, nil
+}
+
+type checker struct {
+	schema Schema
+	loose  bool    // variables missing from schema are of type any
+	elems  []*Type // types of #, innermost predicate last
+	locals []localType
+	errs   TypeErrors
+}
+
+func (c *checker) errorf(n Node, format string, args ...interface{}) {
+	c.errs = append(c.errs, &TypeError{n, fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) check(node Node) *Type {
+	switch n := node.(type) {
+	case IdentNode:
+		t, ok := c.schema[n.val]
+		if !ok && c.loose {
+			return AnyType
+		}
+		if !ok {
+			c.errorf(n, "undefined variable %s", n.val)
+			return AnyType
+		}
+		return t
+	case IntNode:
+		return IntType
+	case FloatNode:
+		return FloatType
+	case BoolNode:
+		return BoolType
+	case StringNode, RegexNode:
+		return StringType
+	case UnaryNode:
+		return c.unary(n, c.check(n.x))
+	case NullNode:
+		return AnyType
+	case LetNode:
+		t := c.check(n.value)
+		c.locals = append(c.locals, localType{n.name, t})
+		defer func() { c.locals = c.locals[:len(c.locals)-1] }()
+		return c.check(n.body)
+	case LocalNode:
+		for i := len(c.locals) - 1; i >= 0; i-- {
+			if c.locals[i].name == n.name {
+				return c.locals[i].t
+			}
+		}
+		if !c.loose {
+			c.errorf(n, "%s is not bound by an enclosing let", n.name)
+		}
+		return AnyType
+	case ElemNode:
+		if len(c.elems) > 0 {
+			return c.elems[len(c.elems)-1]
+		}
+		if !c.loose {
+			c.errorf(n, "# used outside of a predicate")
+		}
+		return AnyType
+	case BinaryNode:
+		if n.op == "??" {
+			// like the path of default, x may refer to variables missing
+			// from the schema
+			loose := c.loose
+			c.loose = true
+			x := c.check(n.x)
+			c.loose = loose
+			return join(x, c.check(n.y))
+		}
+		return c.binary(n, c.check(n.x), c.check(n.y))
+	case CondNode:
+		if t := c.check(n.cond); !assignable(t, BoolType) {
+			c.errorf(n.cond, "invalid condition: %s is not bool", t)
+		}
+		return join(c.check(n.x), c.check(n.y))
+	case ArrayNode:
+		var elem *Type
+		for i, arg := range n.args {
+			if t := c.check(arg); i == 0 {
+				elem = t
+			} else {
+				elem = join(elem, t)
+			}
+		}
+		if elem == nil {
+			elem = AnyType
+		}
+		return ArrayOf(elem)
+	case SetNode:
+		return c.check(ArrayNode{n.elems, n.span})
+	case MapNode:
+		var elem *Type
+		for i, k := range n.keys {
+			if t := c.check(k); t.Kind != Any && t.Kind != String && !t.numeric() {
+				c.errorf(k, "invalid map key type %s", t)
+			}
+			if t := c.check(n.vals[i]); i == 0 {
+				elem = t
+			} else {
+				elem = join(elem, t)
+			}
+		}
+		if elem == nil {
+			elem = AnyType
+		}
+		return MapOf(elem)
+	case FuncNode:
+		return c.call(n)
+	case MemberNode:
+		switch t := c.check(n.x); t.Kind {
+		case Any:
+			return AnyType
+		case Map:
+			return t.Elem
+		default:
+			c.errorf(n, "cannot access field %s of %s", n.name, t)
+			return AnyType
+		}
+	case IndexNode:
+		t, i := c.check(n.x), c.check(n.index)
+		switch t.Kind {
+		case Any:
+			return AnyType
+		case Array:
+			if !assignable(i, IntType) {
+				c.errorf(n.index, "invalid array index type %s", i)
+			}
+			return t.Elem
+		case Map:
+			return t.Elem
+		default:
+			c.errorf(n, "cannot index %s", t)
+			return AnyType
+		}
+	}
+	c.errorf(node, "unexpected node %T", node)
+	return AnyType
+}
+
+func (c *checker) unary(n UnaryNode, x *Type) *Type {
+	switch {
+	case x.Kind == Any:
+		if n.op == "!" {
+			return BoolType
+		}
+		return AnyType
+	case (n.op == "+" || n.op == "-") && x.numeric():
+		return x
+	case n.op == "^" && x.Kind == Int:
+		return IntType
+	case n.op == "!" && x.Kind == Bool:
+		return BoolType
+	}
+	c.errorf(n, "invalid operation: %s %s", n.op, x)
+	return AnyType
+}
+
+func (c *checker) binary(n BinaryNode, x, y *Type) *Type {
+	mismatch := func() *Type {
+		c.errorf(n, "invalid operation: %s %s %s", x, n.op, y)
+		return AnyType
+	}
+	dynamic := x.Kind == Any || y.Kind == Any
+	switch n.op {
+	case "+", "-", "*", "/", "%":
+		switch {
+		case n.op == "%" && (x.Kind == Float || y.Kind == Float):
+			return mismatch()
+		case dynamic:
+			return AnyType
+		case x.numeric() && y.numeric():
+			if x.Kind == Float || y.Kind == Float {
+				return FloatType
+			}
+			return IntType
+		case n.op == "+" && x.Kind == String && y.Kind == String:
+			return StringType
+		}
+		return mismatch()
+	case "**":
+		switch {
+		case dynamic:
+			return AnyType
+		case x.Kind == Float && y.numeric() || x.numeric() && y.Kind == Float:
+			return FloatType
+		case x.Kind == Int && y.Kind == Int:
+			// negative exponents make floats
+			if i, ok := n.y.(IntNode); ok && i.val >= 0 {
+				return IntType
+			}
+			return AnyType
+		}
+		return mismatch()
+	case "&", "|", "^", "&^", "<<", ">>":
+		switch {
+		case x.Kind == Float || y.Kind == Float:
+			return mismatch()
+		case dynamic:
+			return AnyType
+		case x.Kind == Int && y.Kind == Int:
+			return IntType
+		}
+		return mismatch()
+	case "=~", "!~":
+		if assignable(x, StringType) && assignable(y, StringType) {
+			return BoolType
+		}
+		return mismatch()
+	case "<", "<=", ">", ">=":
+		if dynamic || x.numeric() && y.numeric() || x.Kind == String && y.Kind == String {
+			return BoolType
+		}
+		return mismatch()
+	case "==", "!=":
+		// comparing values of different types is always false, so it is reported
+		if dynamic || x.numeric() && y.numeric() || x.Kind == y.Kind {
+			return BoolType
+		}
+		return mismatch()
+	case "&&", "||":
+		if assignable(x, BoolType) && assignable(y, BoolType) {
+			return BoolType
+		}
+		return mismatch()
+	case "in", "not_in":
+		switch y.Kind {
+		case Any, Array, Map:
+			return BoolType
+		}
+		return mismatch()
+	}
+	c.errorf(n, "unsupported binary operator: %q", n.op)
+	return AnyType
+}
+
+func (c *checker) call(n FuncNode) *Type {
+	f := n.f
+	args := make([]*Type, len(n.args))
+	for i, arg := range n.args {
+		if i == 0 && f != nil && f.form.probes() {
+			// the path may refer to variables missing from the schema
+			loose := c.loose
+			c.loose = true
+			args[i] = c.check(arg)
+			c.loose = loose
+			continue
+		}
+		if i == 1 && f != nil && f.form.lambda() {
+			args[i] = c.predicate(arg, args[0])
+			continue
+		}
+		args[i] = c.check(arg)
+	}
+	if f == nil {
+		c.errorf(n, "unknown function %s", n.fn)
+		return AnyType
+	}
+	result := f.Result
+	if result == nil {
+		result = AnyType
+	}
+	if min, max := f.arity(); len(args) < min {
+		c.errorf(n, "not enough arguments in call to %s", n.fn)
+		return result
+	} else if max >= 0 && len(args) > max {
+		c.errorf(n, "too many arguments in call to %s", n.fn)
+		return result
+	}
+	for i, t := range args {
+		if !f.param(i).admits(t) {
+			c.errorf(n.args[i], "invalid argument %d to %s: %s", i+1, n.fn, t)
+		}
+	}
+	switch f.form {
+	case defaultForm:
+		return join(args[0], args[1])
+	case filterForm:
+		if args[0].Kind == Array {
+			return args[0]
+		}
+	case mapForm:
+		return ArrayOf(args[1])
+	}
+	return result
+}
+
+// localType is the type of a value bound by a let.
+type localType struct {
+	name string
+	t    *Type
+}
+
+// predicate checks pred, the predicate of a call like any, with # of the
+// element type of array.
+func (c *checker) predicate(pred Node, array *Type) *Type {
+	elem := AnyType
+	if array.Kind == Array {
+		elem = array.Elem
+	}
+	c.elems = append(c.elems, elem)
+	defer func() { c.elems = c.elems[:len(c.elems)-1] }()
+	return c.check(pred)
+}
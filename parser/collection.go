@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+func (n MapNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	res := make(map[interface{}]interface{}, len(n.keys))
+	for i, k := range n.keys {
+		setKey(res, k.Eval(env), n.vals[i].Eval(env))
+	}
+	if s := limiter(env); s != nil {
+		s.checkLen(n, len(res))
+	}
+	return res
+}
+
+// setKey stores val under the normalized key in a map literal.
+func setKey(m map[interface{}]interface{}, key, val interface{}) {
+	k, ok := mapKey(key)
+	if !ok {
+		panic(&EvalError{Types: typesOf([]interface{}{key}),
+			Msg: fmt.Sprintf("invalid map key type %T", key)})
+	}
+	m[k] = val
+}
+
+// mapKey normalizes a map literal key like hashKey does a set element:
+// strings are kept, integers and whole floats become int64 and other floats
+// float64. Keys that are == are the same key, e.g. 2 and 2.0.
+func mapKey(k interface{}) (interface{}, bool) {
+	switch k.(type) {
+	case nil, bool:
+		return nil, false
+	}
+	return hashKey(k)
+}
+
+// equal reports whether a and b are equal. Maps and arrays are equal when
+// they hold equal elements, compared with eq, so that e.g. an int in the
+// environment equals an int64 literal.
+func equal(a, b interface{}) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isList(x.Kind()) && isList(y.Kind()):
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if eq(x.Index(i).Interface(), y.Index(i).Interface()) != true {
+				return false
+			}
+		}
+		return true
+	case x.Kind() == reflect.Map && y.Kind() == reflect.Map:
+		if x.Len() != y.Len() {
+			return false
+		}
+		iter := x.MapRange()
+		for iter.Next() {
+			v, ok := lookup(y, iter.Key().Interface())
+			if !ok || eq(iter.Value().Interface(), v) != true {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// in reports whether v is an element of the array or a key of the map
+// collection. Anything else contains nothing.
+func in(v, collection interface{}) bool {
+	if s, ok := collection.(*set); ok {
+		return s.has(v)
+	}
+	if list, ok := collection.([]interface{}); ok {
+		for _, x := range list {
+			if eq(v, x) == true {
+				return true
+			}
+		}
+		return false
+	}
+	r := reflect.ValueOf(collection)
+	switch {
+	case isList(r.Kind()):
+		for i := 0; i < r.Len(); i++ {
+			if eq(v, r.Index(i).Interface()) == true {
+				return true
+			}
+		}
+	case r.Kind() == reflect.Map:
+		_, ok := lookup(r, v)
+		return ok
+	}
+	return false
+}
+
+// lookup returns the value stored under key in the map m and whether it
+// is present. A key whose type can't be a key of m can't be present either.
+func lookup(m reflect.Value, key interface{}) (interface{}, bool) {
+	if k, ok := convertKey(reflect.ValueOf(key), m.Type().Key()); ok {
+		if v := m.MapIndex(k); v.IsValid() {
+			return v.Interface(), true
+		}
+	}
+	if m.Type().Key().Kind() == reflect.Interface {
+		// keys of map literals are normalized by mapKey
+		if k, ok := mapKey(key); ok && k != key {
+			if v := m.MapIndex(reflect.ValueOf(k)); v.IsValid() {
+				return v.Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// lengthOf returns the length of a string, array or map.
+func lengthOf(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case string:
+		return int64(len(x)), true
+	case []interface{}:
+		return int64(len(x)), true
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return int64(r.Len()), true
+	}
+	return 0, false
+}
+
+func isList(k reflect.Kind) bool {
+	return k == reflect.Array || k == reflect.Slice
+}
@@ -0,0 +1,438 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Program is an expression compiled to bytecode for a small stack machine.
+// Operators and functions are resolved once, at compile time, and variables
+// are looked up at most once per run. A Program may be run concurrently.
+type Program struct {
+	root     Node
+	code     []instr
+	nodes    []Node // node each instruction was compiled from, for errors
+	consts   []interface{}
+	names    []string // variable names, indexed by slot
+	calls    []call
+	maxStack int
+}
+
+type instr struct {
+	op  opcode
+	arg int32
+}
+
+type call struct {
+	argc int
+	fn   *Function
+}
+
+type opcode uint8
+
+const (
+	opConst  opcode = iota // push consts[arg]
+	opLoad                 // push the variable in slot arg
+	opPos                  // unary +
+	opNeg                  // unary -
+	opNot                  // unary !
+	opBitNot               // unary ^
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opMod
+	opPow
+	opBitAnd
+	opBitOr
+	opBitXor
+	opBitClear
+	opShl
+	opShr
+	opGt
+	opLt
+	opGe
+	opLe
+	opEq
+	opNe
+	opAnd
+	opOr
+	opIn
+	opNotIn
+	opMatch
+	opNotMatch
+	opJumpIfFalse  // jump to arg if the top is false; the top stays on the stack
+	opJumpIfTrue   // jump to arg if the top is true; the top stays on the stack
+	opBranch       // pop a condition and jump to arg if it is false
+	opJump         // jump to arg
+	opArray        // pop arg values and push them as an array
+	opMap          // pop arg key/value pairs and push them as a map
+	opMember       // pop x and push the member consts[arg] of x
+	opIndex        // pop i, x and push x[i]
+	opCall         // pop the arguments of calls[arg] and push its result
+	opProbeLoad    // push the variable in slot arg, nil if it is missing
+	opProbeMember  // like opMember, but nil if x is nil or has no such member
+	opProbeIndex   // like opIndex, but nil if x is nil or i is not in x
+	opNotNil       // replace the top with whether it is not nil
+	opJumpIfNotNil // jump to arg if the top is not nil; the top stays on the stack
+	opJumpIfNil    // jump to arg if the top is nil; it stays on the stack as nil
+	opPop          // pop the top
+	opIter         // replace the array on top with an iterator for the call of calls[arg]
+	opNext         // move the iterator on top to its next element, or jump to arg past the last
+	opElem         // push the element of the iterator in stack slot arg, the value of #
+	opStep         // pop the value of the predicate; jump to arg unless it decides the result
+	opDone         // replace the iterator on top with the result of its call
+	opLet          // push the value of a let, not evaluated yet, and arg-1 slots to evaluate it in
+	opBind         // end the code of the value of a let: push it where it was first used
+	opLocal        // push the value in stack slot arg, bound by a let, evaluating it on first use
+	opUnbind       // pop the result of the body of a let and replace its arg slots with it
+)
+
+var opcodeNames = [...]string{
+	opConst: "const", opLoad: "load", opPos: "pos", opNeg: "neg", opNot: "not", opBitNot: "bit_not",
+	opAdd: "add", opSub: "sub", opMul: "mul", opDiv: "div", opMod: "mod", opPow: "pow",
+	opBitAnd: "bit_and", opBitOr: "bit_or", opBitXor: "bit_xor", opBitClear: "bit_clear", opShl: "shl", opShr: "shr",
+	opGt: "gt", opLt: "lt", opGe: "ge", opLe: "le", opEq: "eq", opNe: "ne",
+	opAnd: "and", opOr: "or", opIn: "in", opNotIn: "not_in",
+	opMatch: "match", opNotMatch: "not_match",
+	opJumpIfFalse: "jump_if_false", opJumpIfTrue: "jump_if_true",
+	opBranch: "branch", opJump: "jump", opArray: "array", opMap: "map",
+	opMember: "member", opIndex: "index", opCall: "call",
+	opProbeLoad: "probe_load", opProbeMember: "probe_member", opProbeIndex: "probe_index",
+	opNotNil: "not_nil", opJumpIfNotNil: "jump_if_not_nil", opJumpIfNil: "jump_if_nil", opPop: "pop",
+	opIter: "iter", opNext: "next", opElem: "elem", opStep: "step", opDone: "done",
+	opLet: "let", opBind: "bind", opLocal: "local", opUnbind: "unbind",
+}
+
+func (op opcode) String() string {
+	return opcodeNames[op]
+}
+
+var unaryOps = map[string]opcode{
+	"+": opPos,
+	"-": opNeg,
+	"!": opNot,
+	"^": opBitNot,
+}
+
+var binaryOps = map[string]opcode{
+	"+":      opAdd,
+	"-":      opSub,
+	"*":      opMul,
+	"/":      opDiv,
+	"%":      opMod,
+	"**":     opPow,
+	"&":      opBitAnd,
+	"|":      opBitOr,
+	"^":      opBitXor,
+	"&^":     opBitClear,
+	"<<":     opShl,
+	">>":     opShr,
+	">":      opGt,
+	"<":      opLt,
+	">=":     opGe,
+	"<=":     opLe,
+	"==":     opEq,
+	"!=":     opNe,
+	"in":     opIn,
+	"not_in": opNotIn,
+	"=~":     opMatch,
+	"!~":     opNotMatch,
+}
+
+// Compile lowers node to a Program. Operators it does not know are reported
+// here, as an *EvalError, instead of when the program runs.
+func Compile(node Node) (_ *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*EvalError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	c := &compiler{
+		prog:   &Program{root: node},
+		consts: make(map[interface{}]int),
+		slots:  make(map[string]int),
+	}
+	c.compile(node)
+	return c.prog, nil
+}
+
+type compiler struct {
+	prog   *Program
+	consts map[interface{}]int // index of each constant in prog.consts
+	slots  map[string]int      // slot of each variable
+	depth  int                 // stack depth after the code emitted so far
+	iters  []int               // stack slots of the iterators of the enclosing predicates
+	locals []localSlot         // names bound by the enclosing lets, innermost last
+}
+
+// localSlot is the stack slot holding the value bound to name by a let.
+type localSlot struct {
+	name string
+	slot int
+}
+
+// emit appends an instruction that changes the stack depth by delta and
+// returns its address.
+func (c *compiler) emit(n Node, op opcode, arg int, delta int) int {
+	c.prog.code = append(c.prog.code, instr{op, int32(arg)})
+	c.prog.nodes = append(c.prog.nodes, n)
+	c.depth += delta
+	if c.depth > c.prog.maxStack {
+		c.prog.maxStack = c.depth
+	}
+	return len(c.prog.code) - 1
+}
+
+// patch makes the jump at addr go to the next instruction emitted.
+func (c *compiler) patch(addr int) {
+	c.prog.code[addr].arg = int32(len(c.prog.code))
+}
+
+func (c *compiler) constant(v interface{}) int {
+	if i, ok := c.consts[v]; ok {
+		return i
+	}
+	c.prog.consts = append(c.prog.consts, v)
+	c.consts[v] = len(c.prog.consts) - 1
+	return len(c.prog.consts) - 1
+}
+
+func (c *compiler) slot(name string) int {
+	if i, ok := c.slots[name]; ok {
+		return i
+	}
+	c.prog.names = append(c.prog.names, name)
+	c.slots[name] = len(c.prog.names) - 1
+	return len(c.prog.names) - 1
+}
+
+func (c *compiler) compile(node Node) {
+	switch n := node.(type) {
+	case IdentNode:
+		c.emit(n, opLoad, c.slot(n.val), 1)
+	case IntNode:
+		c.emit(n, opConst, c.constant(n.val), 1)
+	case FloatNode:
+		c.emit(n, opConst, c.constant(n.val), 1)
+	case BoolNode:
+		c.emit(n, opConst, c.constant(n.val), 1)
+	case StringNode:
+		c.emit(n, opConst, c.constant(n.val), 1)
+	case UnaryNode:
+		op, ok := unaryOps[n.op]
+		if !ok {
+			panic(&EvalError{Node: n, Op: n.op, Msg: fmt.Sprintf("unsupported unary operator: %q", n.op)})
+		}
+		c.compile(n.x)
+		c.emit(n, op, 0, 0)
+	case BinaryNode:
+		switch n.op {
+		case "&&", "||":
+			jump, op := opJumpIfFalse, opAnd
+			if n.op == "||" {
+				jump, op = opJumpIfTrue, opOr
+			}
+			c.compile(n.x)
+			addr := c.emit(n, jump, 0, 0)
+			c.compile(n.y)
+			c.emit(n, op, 0, -1)
+			c.patch(addr)
+			return
+		case "??":
+			c.probe(n.x)
+			jump := c.emit(n, opJumpIfNotNil, 0, 0)
+			c.emit(n, opPop, 0, -1)
+			c.compile(n.y)
+			c.patch(jump)
+			return
+		}
+		op, ok := binaryOps[n.op]
+		if !ok {
+			panic(&EvalError{Node: n, Op: n.op, Msg: fmt.Sprintf("unsupported binary operator: %q", n.op)})
+		}
+		c.compile(n.x)
+		c.compile(n.y)
+		c.emit(n, op, 0, -1)
+	case CondNode:
+		c.compile(n.cond)
+		branch := c.emit(n, opBranch, 0, -1)
+		c.compile(n.x)
+		// the else branch starts from the depth before the then branch
+		jump := c.emit(n, opJump, 0, -1)
+		c.patch(branch)
+		c.compile(n.y)
+		c.patch(jump)
+	case ArrayNode:
+		for _, arg := range n.args {
+			c.compile(arg)
+		}
+		c.emit(n, opArray, len(n.args), 1-len(n.args))
+	case MapNode:
+		for i, k := range n.keys {
+			c.compile(k)
+			c.compile(n.vals[i])
+		}
+		c.emit(n, opMap, len(n.keys), 1-2*len(n.keys))
+	case FuncNode:
+		if n.f == nil {
+			panic(&EvalError{Node: n, Func: n.fn, Msg: fmt.Sprintf("unknown function %s", n.fn)})
+		}
+		if n.f.form.lambda() {
+			c.each(n)
+			return
+		}
+		switch n.f.form {
+		case definedForm:
+			c.probe(n.args[0])
+			c.emit(n, opNotNil, 0, 0)
+			return
+		case defaultForm:
+			c.probe(n.args[0])
+			jump := c.emit(n, opJumpIfNotNil, 0, 0)
+			c.emit(n, opPop, 0, -1)
+			c.compile(n.args[1])
+			c.patch(jump)
+			return
+		}
+		for _, arg := range n.args {
+			c.compile(arg)
+		}
+		c.prog.calls = append(c.prog.calls, call{len(n.args), n.f})
+		c.emit(n, opCall, len(c.prog.calls)-1, 1-len(n.args))
+	case MemberNode:
+		c.compile(n.x)
+		if n.optional {
+			jump := c.emit(n, opJumpIfNil, 0, 0)
+			c.emit(n, opMember, c.constant(n.name), 0)
+			c.patch(jump)
+			return
+		}
+		c.emit(n, opMember, c.constant(n.name), 0)
+	case IndexNode:
+		c.compile(n.x)
+		if n.optional {
+			jump := c.emit(n, opJumpIfNil, 0, 0)
+			c.compile(n.index)
+			c.emit(n, opIndex, 0, -1)
+			c.patch(jump)
+			return
+		}
+		c.compile(n.index)
+		c.emit(n, opIndex, 0, -1)
+	case NullNode:
+		c.emit(n, opConst, c.constant(nil), 1)
+	case LetNode:
+		// The value is compiled out of line and run on its first use, in
+		// slots reserved below the body.
+		slot, max := c.depth, c.prog.maxStack
+		let := c.emit(n, opLet, 0, 0)
+		skip := c.emit(n, opJump, 0, 0)
+		c.prog.maxStack = slot
+		c.depth = slot
+		c.compile(n.value)
+		c.emit(n, opBind, 0, -1)
+		c.patch(skip)
+		size := c.prog.maxStack - slot
+		if max > c.prog.maxStack {
+			c.prog.maxStack = max
+		}
+		c.prog.code[let].arg = int32(size)
+		c.depth = slot + size
+		c.locals = append(c.locals, localSlot{n.name, slot})
+		c.compile(n.body)
+		c.locals = c.locals[:len(c.locals)-1]
+		c.emit(n, opUnbind, size, -size)
+	case LocalNode:
+		slot := -1
+		for i := len(c.locals) - 1; i >= 0 && slot < 0; i-- {
+			if c.locals[i].name == n.name {
+				slot = c.locals[i].slot
+			}
+		}
+		if slot < 0 {
+			panic(&EvalError{Node: n, Msg: fmt.Sprintf("%s is not bound by an enclosing let", n.name)})
+		}
+		c.emit(n, opLocal, slot, 1)
+	case ElemNode:
+		if len(c.iters) == 0 {
+			panic(&EvalError{Node: n, Msg: "# used outside of a predicate"})
+		}
+		c.emit(n, opElem, c.iters[len(c.iters)-1], 1)
+	case SetNode:
+		c.emit(n, opConst, c.constant(n.set), 1)
+	case RegexNode:
+		c.emit(n, opConst, c.constant(n.re), 1)
+	default:
+		panic(&EvalError{Node: n, Msg: fmt.Sprintf("cannot compile %T", n)})
+	}
+}
+
+// each compiles n, a call in a lambda form, to a loop over the elements
+// of its array, which keeps its iterator on the stack:
+//
+//	array; iter; loop: next done; pred; step loop; done: done
+func (c *compiler) each(n FuncNode) {
+	c.compile(n.args[0])
+	c.prog.calls = append(c.prog.calls, call{len(n.args), n.f})
+	c.emit(n, opIter, len(c.prog.calls)-1, 0)
+	c.iters = append(c.iters, c.depth-1)
+	loop := c.emit(n, opNext, 0, 0)
+	c.compile(n.args[1])
+	c.emit(n, opStep, loop, -1)
+	c.patch(loop)
+	c.emit(n, opDone, 0, 0)
+	c.iters = c.iters[:len(c.iters)-1]
+}
+
+// probe compiles the path n like compile, except that it yields nil instead
+// of failing when a variable, field, key or index along it is missing.
+func (c *compiler) probe(node Node) {
+	switch n := node.(type) {
+	case IdentNode:
+		c.emit(n, opProbeLoad, c.slot(n.val), 1)
+	case MemberNode:
+		c.probe(n.x)
+		c.emit(n, opProbeMember, c.constant(n.name), 0)
+	case IndexNode:
+		c.probe(n.x)
+		c.compile(n.index)
+		c.emit(n, opProbeIndex, 0, -1)
+	default:
+		c.compile(n)
+	}
+}
+
+// String disassembles the program, one instruction per line.
+func (p *Program) String() string {
+	var b strings.Builder
+	for pc, ins := range p.code {
+		var arg interface{}
+		switch ins.op {
+		case opConst, opMember, opProbeMember:
+			if re, ok := p.consts[ins.arg].(*regexp.Regexp); ok {
+				arg = fmt.Sprintf("regexp(%q)", re)
+				break
+			}
+			arg = fmt.Sprintf("%#v", p.consts[ins.arg])
+		case opLoad, opProbeLoad:
+			arg = p.names[ins.arg]
+		case opCall, opIter:
+			arg = fmt.Sprintf("%s/%d", p.calls[ins.arg].fn.Name, p.calls[ins.arg].argc)
+		case opJumpIfFalse, opJumpIfTrue, opJumpIfNotNil, opJumpIfNil, opBranch, opJump, opArray, opMap,
+			opNext, opElem, opStep, opLet, opLocal, opUnbind:
+			arg = ins.arg
+		}
+		if arg == nil {
+			fmt.Fprintf(&b, "%04d %s\n", pc, ins.op)
+		} else {
+			fmt.Fprintf(&b, "%04d %-13s %v\n", pc, ins.op, arg)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Vars returns the sorted names of the variables node reads.
+func Vars(node Node) []string {
+	d := newDeps()
+	d.visit(node)
+	return sorted(d.vars)
+}
+
+// Funcs returns the sorted names of the functions node calls.
+func Funcs(node Node) []string {
+	d := newDeps()
+	d.visit(node)
+	return sorted(d.funcs)
+}
+
+// Paths returns the sorted access paths node reads: each variable followed
+// by as many of its member accesses and constant indexes as the expression
+// spells out, e.g. user.profile.age or tags[0]. An index that isn't a
+// constant ends the path, so user.tags[i].name reads user.tags (and i).
+func Paths(node Node) []string {
+	d := newDeps()
+	d.visit(node)
+	return sorted(d.paths)
+}
+
+type deps struct {
+	vars, funcs, paths map[string]bool
+}
+
+func newDeps() *deps {
+	return &deps{
+		vars:  make(map[string]bool),
+		funcs: make(map[string]bool),
+		paths: make(map[string]bool),
+	}
+}
+
+func (d *deps) visit(node Node) {
+	switch n := node.(type) {
+	case IdentNode, MemberNode, IndexNode:
+		if path, ok := d.path(n); ok {
+			d.paths[path] = true
+		}
+	case UnaryNode:
+		d.visit(n.x)
+	case BinaryNode:
+		d.visit(n.x)
+		d.visit(n.y)
+	case CondNode:
+		d.visit(n.cond)
+		d.visit(n.x)
+		d.visit(n.y)
+	case LetNode:
+		d.visit(n.value)
+		d.visit(n.body)
+	case ArrayNode:
+		for _, arg := range n.args {
+			d.visit(arg)
+		}
+	case MapNode:
+		for i, k := range n.keys {
+			d.visit(k)
+			d.visit(n.vals[i])
+		}
+	case FuncNode:
+		d.funcs[n.fn] = true
+		for _, arg := range n.args {
+			d.visit(arg)
+		}
+	}
+}
+
+// path visits the operands of n, a variable, member access or index, and
+// returns the access path n spells out, if it starts at a variable and
+// only takes constant indexes. Otherwise the longest such prefix is
+// recorded as a path of its own.
+func (d *deps) path(node Node) (string, bool) {
+	switch n := node.(type) {
+	case IdentNode:
+		d.vars[n.val] = true
+		return n.val, true
+	case MemberNode:
+		if x, ok := d.path(n.x); ok {
+			return x + "." + n.name, true
+		}
+		return "", false
+	case IndexNode:
+		x, ok := d.path(n.x)
+		switch i := n.index.(type) {
+		case IntNode:
+			if ok {
+				return x + "[" + strconv.FormatInt(i.val, 10) + "]", true
+			}
+		case StringNode:
+			if ok {
+				return x + "[" + strconv.Quote(i.val) + "]", true
+			}
+		default:
+			d.visit(n.index)
+			if ok {
+				d.paths[x] = true
+			}
+		}
+		return "", false
+	}
+	d.visit(node)
+	return "", false
+}
+
+func sorted(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for s := range set {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Resolver looks up the variables of an expression. Hosts can implement
+// it to supply variables lazily, without building a map up front.
+type Resolver interface {
+	Get(name string) (interface{}, bool)
+}
+
+// Env is a Resolver holding variables in a map.
+type Env map[string]interface{}
+
+func (e Env) Get(name string) (interface{}, bool) {
+	v, ok := e[name]
+	return v, ok
+}
+
+// EnvOf returns a Resolver for the variables in v, which may be a Resolver,
+// a map with string keys, or a struct or pointer to one. Struct fields are
+// named by their `expr:"name"` tag, or by their Go name when untagged; a
+// field tagged `expr:"-"` is hidden.
+func EnvOf(v interface{}) (Resolver, error) {
+	switch env := v.(type) {
+	case nil:
+		return Env(nil), nil
+	case Env: // the common case, checked before the slower interface match
+		return env, nil
+	case Resolver:
+		return env, nil
+	case map[string]interface{}:
+		return Env(env), nil
+	}
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr && !r.IsNil() {
+		r = r.Elem()
+	}
+	switch {
+	case r.Kind() == reflect.Struct:
+		return valueEnv{r}, nil
+	case r.Kind() == reflect.Map && r.Type().Key().Kind() == reflect.String:
+		return valueEnv{r}, nil
+	case r.Kind() == reflect.Ptr:
+		return Env(nil), nil // a nil pointer has no variables
+	}
+	return nil, fmt.Errorf("invalid environment %T: want a map with string keys, a struct or a Resolver", v)
+}
+
+// EvalOption configures EvalE and Program.Run.
+type EvalOption func(*evalConfig)
+
+type evalConfig struct {
+	strict bool
+}
+
+// Strict makes a variable missing from the environment an error, wrapping
+// an *UndefinedVariableError, instead of nil. The arguments of defined and
+// default may still refer to missing variables.
+func Strict() EvalOption {
+	return func(c *evalConfig) { c.strict = true }
+}
+
+// scope returns the Resolver for evaluating in v, which EvalE and
+// Program.Run report as an *EvalError when v is not an environment.
+func scope(v interface{}, opts []EvalOption) Resolver {
+	env, err := EnvOf(v)
+	if err != nil {
+		panic(&EvalError{Types: typesOf([]interface{}{v}), Msg: err.Error(), Err: err})
+	}
+	if len(opts) == 0 {
+		return env // without allocating a config
+	}
+	var c evalConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.strict {
+		return &state{Resolver: env, strict: true}
+	}
+	return env
+}
+
+// isStrict reports whether missing variables are errors in env.
+func isStrict(env Resolver) bool {
+	s, ok := env.(*state)
+	return ok && s.strict
+}
+
+// valueEnv resolves variables to the fields of a struct or the entries of
+// a map.
+type valueEnv struct {
+	r reflect.Value
+}
+
+func (e valueEnv) Get(name string) (interface{}, bool) {
+	if e.r.Kind() == reflect.Map {
+		return lookup(e.r, name)
+	}
+	return field(e.r, name)
+}
+
+// field returns the field name of the struct r, honouring expr tags. A
+// field promoted through a nil embedded pointer is nil.
+func field(r reflect.Value, name string) (interface{}, bool) {
+	i, ok := fieldsOf(r.Type())[name]
+	if !ok {
+		return nil, false
+	}
+	f, err := r.FieldByIndexErr(i)
+	if err != nil {
+		return nil, true
+	}
+	return f.Interface(), true
+}
+
+var fieldCache sync.Map // reflect.Type -> map[string][]int
+
+// fieldsOf returns the index of each exported field of the struct type t,
+// including promoted ones, by expression name.
+func fieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("expr"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+		// a shallower field hides a deeper one of the same name
+		if i, ok := fields[name]; !ok || len(f.Index) < len(i) {
+			fields[name] = f.Index
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/Cauchy-NY/eval/lexer"
+	"regexp"
+	"strings"
+)
+
+// ParseError describes malformed input. For lexical errors, such as an
+// unrecognized character, Token is the zero Token and Expected is empty.
+type ParseError struct {
+	Input    string
+	Pos      lexer.Position // where the offending token starts
+	Token    lexer.Token    // offending token
+	Expected []string       // tokens that would have been accepted instead
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+	switch len(e.Expected) {
+	case 0:
+	case 1:
+		msg += ", expected " + e.Expected[0]
+	default:
+		msg += ", expected one of " + strings.Join(e.Expected, ", ")
+	}
+	return msg
+}
+
+// Snippet renders the input line holding the error with a caret under
+// the offending column, e.g.
+//
+//	a > > 3
+//	    ^
+func (e *ParseError) Snippet() string {
+	start := strings.LastIndexByte(e.Input[:e.Pos.Offset], '\n') + 1
+	end := strings.IndexByte(e.Input[e.Pos.Offset:], '\n')
+	if end < 0 {
+		end = len(e.Input)
+	} else {
+		end += e.Pos.Offset
+	}
+	line := e.Input[start:end]
+
+	var pad strings.Builder
+	for _, r := range e.Input[start:e.Pos.Offset] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	return line + "\n" + pad.String() + "^"
+}
+
+// EvalError describes an expression that failed at run time, e.g. an
+// operator applied to mismatched types or a bad function call.
+type EvalError struct {
+	Node  Node     // innermost node that failed
+	Op    string   // operator, for unary and binary operations
+	Func  string   // function name, for calls
+	Types []string // dynamic types of the operands or arguments
+	Msg   string
+	Err   error // underlying error, if any
+}
+
+func (e *EvalError) Error() string {
+	return e.Msg
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// UndefinedVariableError reports a variable missing from the environment
+// of a strict evaluation. It is wrapped in an *EvalError that points at
+// the variable.
+type UndefinedVariableError struct {
+	Name string
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return "undefined variable " + e.Name
+}
+
+func undefined(n IdentNode) *EvalError {
+	err := &UndefinedVariableError{n.val}
+	return &EvalError{Node: n, Msg: err.Error(), Err: err}
+}
+
+// EvalE evaluates node in env, reporting runtime failures as *EvalError
+// instead of panicking. env is anything EnvOf accepts.
+func EvalE(node Node, env interface{}, opts ...EvalOption) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := toEvalError(r)
+			if e.Node == nil {
+				e.Node = node
+			}
+			err = e
+		}
+	}()
+	return node.Eval(scope(env, opts)), nil
+}
+
+// annotate re-raises r, a panic recovered while evaluating n, as an
+// *EvalError that points at n. Errors raised by a child of n already carry
+// their own node and pass through untouched.
+func annotate(r interface{}, n Node) {
+	e := toEvalError(r)
+	if e.Node == nil {
+		e.Node = n
+	}
+	panic(e)
+}
+
+func toEvalError(r interface{}) *EvalError {
+	switch x := r.(type) {
+	case *EvalError:
+		return x
+	case error:
+		return &EvalError{Msg: x.Error(), Err: x}
+	}
+	return &EvalError{Msg: fmt.Sprint(r)}
+}
+
+func typesOf(vals []interface{}) []string {
+	types := make([]string, len(vals))
+	for i, v := range vals {
+		if _, ok := v.(*regexp.Regexp); ok {
+			types[i] = "string" // a pattern literal, compiled ahead of time
+			continue
+		}
+		types[i] = fmt.Sprintf("%T", v)
+	}
+	return types
+}
+
+func opError(op string, operands ...interface{}) *EvalError {
+	types := typesOf(operands)
+	var msg string
+	if len(types) == 1 {
+		msg = fmt.Sprintf("invalid operation: %s %s", op, types[0])
+	} else {
+		msg = fmt.Sprintf("invalid operation: %s %s %s", types[0], op, types[1])
+	}
+	return &EvalError{Op: op, Types: types, Msg: msg}
+}
+
+// shiftError is the error of a shift by a negative count.
+func shiftError(op string, a, b interface{}) *EvalError {
+	e := opError(op, a, b)
+	e.Msg += " (negative shift amount)"
+	return e
+}
+
+func argError(fn string, args ...interface{}) *EvalError {
+	types := typesOf(args)
+	msg := fmt.Sprintf("invalid arguments: %s(%s)", fn, strings.Join(types, ", "))
+	return &EvalError{Func: fn, Types: types, Msg: msg}
+}
@@ -4,29 +4,56 @@ import (
 	"fmt"
 )
 
-type Env map[string]interface{}
-
-func (n IdentNode) Eval(env Env) interface{} {
-	return env[n.val]
+func (n IdentNode) Eval(env Resolver) interface{} {
+	if env == nil {
+		return nil
+	}
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	v, ok := env.Get(n.val)
+	if !ok && isStrict(env) {
+		panic(undefined(n))
+	}
+	return v
 }
 
-func (n IntNode) Eval(env Env) interface{} {
+func (n IntNode) Eval(env Resolver) interface{} {
 	return n.val
 }
 
-func (n FloatNode) Eval(env Env) interface{} {
+func (n FloatNode) Eval(env Resolver) interface{} {
 	return n.val
 }
 
-func (n BoolNode) Eval(env Env) interface{} {
+func (n BoolNode) Eval(env Resolver) interface{} {
 	return n.val
 }
 
-func (n StringNode) Eval(env Env) interface{} {
+func (n StringNode) Eval(env Resolver) interface{} {
 	return n.val
 }
 
-func (n UnaryNode) Eval(env Env) interface{} {
+func (n NullNode) Eval(env Resolver) interface{} {
+	return nil
+}
+
+func (n ElemNode) Eval(env Resolver) interface{} {
+	if s, ok := env.(*state); ok && s.bound {
+		return s.elem
+	}
+	panic(&EvalError{Node: n, Msg: "# used outside of a predicate"})
+}
+
+func (n UnaryNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
 	switch n.op {
 	case "+":
 		return add(0, n.x.Eval(env))
@@ -34,14 +61,28 @@ func (n UnaryNode) Eval(env Env) interface{} {
 		return sub(0, n.x.Eval(env))
 	case "!":
 		return not(n.x.Eval(env))
+	case "^":
+		return bitNot(n.x.Eval(env))
 	}
-	panic(fmt.Sprintf("unsupported unary operator: %q", n.op))
+	panic(&EvalError{Op: n.op, Msg: fmt.Sprintf("unsupported unary operator: %q", n.op)})
 }
 
-func (n BinaryNode) Eval(env Env) interface{} {
+func (n BinaryNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
 	switch n.op {
 	case "+":
-		return add(n.x.Eval(env), n.y.Eval(env))
+		v := add(n.x.Eval(env), n.y.Eval(env))
+		if s := limiter(env); s != nil {
+			s.checkSize(n, v)
+		}
+		return v
 	case "-":
 		return sub(n.x.Eval(env), n.y.Eval(env))
 	case "*":
@@ -50,6 +91,20 @@ func (n BinaryNode) Eval(env Env) interface{} {
 		return div(n.x.Eval(env), n.y.Eval(env))
 	case "%":
 		return mod(n.x.Eval(env), n.y.Eval(env))
+	case "**":
+		return power(n.x.Eval(env), n.y.Eval(env))
+	case "&":
+		return bitAnd(n.x.Eval(env), n.y.Eval(env))
+	case "|":
+		return bitOr(n.x.Eval(env), n.y.Eval(env))
+	case "^":
+		return bitXor(n.x.Eval(env), n.y.Eval(env))
+	case "&^":
+		return bitClear(n.x.Eval(env), n.y.Eval(env))
+	case "<<":
+		return shl(n.x.Eval(env), n.y.Eval(env))
+	case ">>":
+		return shr(n.x.Eval(env), n.y.Eval(env))
 	case ">":
 		return gt(n.x.Eval(env), n.y.Eval(env))
 	case "<":
@@ -63,45 +118,199 @@ func (n BinaryNode) Eval(env Env) interface{} {
 	case "!=":
 		return ne(n.x.Eval(env), n.y.Eval(env))
 	case "&&":
-		return and(n.x.Eval(env), n.y.Eval(env))
+		// the right operand is only evaluated when the left one is not false
+		x := n.x.Eval(env)
+		if b, ok := x.(bool); ok && !b {
+			return false
+		}
+		return and(x, n.y.Eval(env))
 	case "||":
-		return or(n.x.Eval(env), n.y.Eval(env))
+		// the right operand is only evaluated when the left one is not true
+		x := n.x.Eval(env)
+		if b, ok := x.(bool); ok && b {
+			return true
+		}
+		return or(x, n.y.Eval(env))
+	case "??":
+		// the left operand is probed like the path of default, and the
+		// right one only evaluated when it is nil
+		if v, ok := probe(n.x, env); ok {
+			return v
+		}
+		return n.y.Eval(env)
 	case "in":
-		return n.inArray(env)
+		return in(n.x.Eval(env), n.y.Eval(env))
 	case "not_in":
-		return n.notInArray(env)
+		return !in(n.x.Eval(env), n.y.Eval(env))
+	case "=~":
+		return match(n.op, n.x.Eval(env), n.y.Eval(env))
+	case "!~":
+		return !match(n.op, n.x.Eval(env), n.y.Eval(env))
 	}
-	panic(fmt.Sprintf("unsupported binary operator: %q", n.op))
+	panic(&EvalError{Op: n.op, Msg: fmt.Sprintf("unsupported binary operator: %q", n.op)})
 }
 
-func (n ArrayNode) Eval(env Env) interface{} {
+func (n CondNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	// only the chosen branch is evaluated
+	if truth(n.cond.Eval(env)) {
+		return n.x.Eval(env)
+	}
+	return n.y.Eval(env)
+}
+
+// truth returns the value of a condition, which must be a bool.
+func truth(c interface{}) bool {
+	if b, ok := c.(bool); ok {
+		return b
+	}
+	panic(&EvalError{Op: "?:", Types: typesOf([]interface{}{c}),
+		Msg: fmt.Sprintf("invalid condition: %T is not bool", c)})
+}
+
+func (n ArrayNode) Eval(env Resolver) interface{} {
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
 	var res []interface{}
 	for _, v := range n.args {
 		res = append(res, v.Eval(env))
 	}
+	if s := limiter(env); s != nil {
+		s.checkLen(n, len(res))
+	}
 	return res
 }
 
-func (n FuncNode) Eval(env Env) interface{} {
-	switch n.fn {
-	case "pow":
-		return n.pow(env)
-	case "sin":
-		return n.sin(env)
-	case "sqrt":
-		return n.sqrt(env)
-	case "len":
-		return n.len(env)
-	case "lower":
-		return n.lower(env)
-	case "str_index":
-		return n.index(env)
-	case "contains":
-		return n.contains(env)
-	case "has_prefix":
-		return n.hasPrefix(env)
-	case "has_suffix":
-		return n.hasSuffix(env)
-	}
-	panic(fmt.Sprintf("unsupported function call: %s", n.fn))
+func (n FuncNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	if n.f == nil {
+		panic(&EvalError{Func: n.fn, Msg: fmt.Sprintf("unknown function %s", n.fn)})
+	}
+	if n.f.form.lambda() {
+		return n.each(env)
+	}
+	switch n.f.form {
+	case definedForm:
+		_, ok := probe(n.args[0], env)
+		return ok
+	case defaultForm:
+		if v, ok := probe(n.args[0], env); ok {
+			return v
+		}
+		return n.args[1].Eval(env)
+	}
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.Eval(env)
+	}
+	v := n.f.call(args)
+	if s := limiter(env); s != nil {
+		s.checkSize(n, v)
+	}
+	return v
+}
+
+func (n MemberNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	x := n.x.Eval(env)
+	if isNil(x) && n.optional {
+		return nil
+	}
+	return member(x, n.name)
+}
+
+func (n IndexNode) Eval(env Resolver) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			annotate(r, n)
+		}
+	}()
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	x := n.x.Eval(env)
+	if isNil(x) && n.optional {
+		return nil // the index isn't evaluated
+	}
+	return index(x, n.index.Eval(env))
+}
+
+// probe evaluates the path n, a variable followed by any number of member
+// accesses and indexes, and reports whether it is defined: the variable and
+// every field, key and index along the path exist and the value isn't nil.
+// Missing variables are not errors here, even in strict mode.
+func probe(n Node, env Resolver) (interface{}, bool) {
+	var v interface{}
+	switch n := n.(type) {
+	case IdentNode:
+		if env == nil {
+			return nil, false
+		}
+		v, _ = env.Get(n.val)
+	case MemberNode:
+		x, ok := probe(n.x, env)
+		if !ok {
+			return nil, false
+		}
+		v = try(func() interface{} { return member(x, n.name) })
+	case IndexNode:
+		x, ok := probe(n.x, env)
+		if !ok {
+			return nil, false
+		}
+		i := n.index.Eval(env)
+		v = try(func() interface{} { return index(x, i) })
+	default:
+		v = n.Eval(env)
+	}
+	return v, !isNil(v)
+}
+
+// try returns the result of f, or nil if f fails with an *EvalError.
+func try(f func() interface{}) (v interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*EvalError); !ok {
+				panic(r)
+			}
+			v = nil
+		}
+	}()
+	return f()
+}
+
+// isPath reports whether n is a variable, or a name bound by a let,
+// followed by any number of member accesses and indexes.
+func isPath(n Node) bool {
+	switch n := n.(type) {
+	case IdentNode, LocalNode:
+		return true
+	case MemberNode:
+		return isPath(n.x)
+	case IndexNode:
+		return isPath(n.x)
+	}
+	return false
 }
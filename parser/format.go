@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Format returns the canonical source of node: operators in their symbolic
+// form (&& for and, > for gt, ...), single spaces around binary operators
+// and only the parentheses precedence requires. Parsing the result yields
+// the same tree.
+func Format(node Node) string {
+	var b strings.Builder
+	write(&b, node, 0)
+	return b.String()
+}
+
+// Binding powers of the forms that aren't binary operators, which take
+// 1 to 8 from precedence. ** binds tighter than the unary operators.
+const (
+	condPrec    = 0
+	unaryPrec   = 9
+	powerPrec   = 10
+	postfixPrec = 11 // member accesses, indexes, calls and literals
+)
+
+// prec returns the binding power of node.
+func prec(node Node) int {
+	switch n := node.(type) {
+	case CondNode, LetNode:
+		return condPrec
+	case BinaryNode:
+		if n.op == "**" {
+			return powerPrec
+		}
+		return precedence(n.op)
+	case UnaryNode:
+		return unaryPrec
+	case IntNode:
+		if n.val < 0 && n.val != math.MinInt64 {
+			return unaryPrec
+		}
+	case FloatNode:
+		if n.val < 0 || n.val == 0 && math.Signbit(n.val) {
+			return unaryPrec
+		}
+	}
+	return postfixPrec
+}
+
+// write writes node, in parentheses if it binds looser than min.
+func write(b *strings.Builder, node Node, min int) {
+	if prec(node) < min {
+		b.WriteByte('(')
+		write(b, node, 0)
+		b.WriteByte(')')
+		return
+	}
+	switch n := node.(type) {
+	case IdentNode:
+		b.WriteString(n.val)
+	case IntNode:
+		if n.val == math.MinInt64 {
+			// -9223372036854775808 would read back as the negation of an
+			// out of range literal
+			b.WriteString("(-9223372036854775807 - 1)")
+			break
+		}
+		b.WriteString(strconv.FormatInt(n.val, 10))
+	case FloatNode:
+		s := strconv.FormatFloat(n.val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0" // or it would read back as an int
+		}
+		b.WriteString(s)
+	case BoolNode:
+		b.WriteString(strconv.FormatBool(n.val))
+	case NullNode:
+		b.WriteString("null")
+	case ElemNode:
+		b.WriteString("#")
+	case LocalNode:
+		b.WriteString(n.name)
+	case LetNode:
+		fmt.Fprintf(b, "let %s = ", n.name)
+		write(b, n.value, condPrec)
+		b.WriteString("; ")
+		write(b, n.body, condPrec)
+	case StringNode:
+		b.WriteString(strconv.Quote(n.val))
+	case RegexNode:
+		b.WriteString(strconv.Quote(n.Pattern()))
+	case UnaryNode:
+		b.WriteString(n.op)
+		write(b, n.x, unaryPrec)
+	case BinaryNode:
+		p := precedence(n.op)
+		left, right := p, p+1
+		if n.op == "**" {
+			// the exponent may be another power or have a unary operator
+			left, right = postfixPrec, unaryPrec
+		}
+		write(b, n.x, left)
+		fmt.Fprintf(b, " %s ", n.op)
+		write(b, n.y, right)
+	case CondNode:
+		write(b, n.cond, condPrec+1)
+		b.WriteString(" ? ")
+		write(b, n.x, condPrec)
+		b.WriteString(" : ")
+		write(b, n.y, condPrec)
+	case ArrayNode:
+		writeList(b, "[", n.args, "]")
+	case SetNode:
+		writeList(b, "[", n.elems, "]")
+	case MapNode:
+		b.WriteByte('{')
+		for i, k := range n.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			write(b, k, 0)
+			b.WriteString(": ")
+			write(b, n.vals[i], 0)
+		}
+		b.WriteByte('}')
+	case FuncNode:
+		writeList(b, n.fn+"(", n.args, ")")
+	case MemberNode:
+		if _, ok := n.x.(IntNode); ok {
+			// 1.x would read as the float 1. followed by x
+			write(b, n.x, postfixPrec+1)
+		} else {
+			write(b, n.x, postfixPrec)
+		}
+		if n.optional {
+			b.WriteString("?")
+		}
+		b.WriteString(".")
+		b.WriteString(n.name)
+	case IndexNode:
+		write(b, n.x, postfixPrec)
+		if n.optional {
+			b.WriteString("?.")
+		}
+		b.WriteString("[")
+		write(b, n.index, 0)
+		b.WriteString("]")
+	default:
+		panic(fmt.Sprintf("unknown node: %T", n))
+	}
+}
+
+func writeList(b *strings.Builder, open string, nodes []Node, close string) {
+	b.WriteString(open)
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		write(b, n, 0)
+	}
+	b.WriteString(close)
+}
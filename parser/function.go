@@ -0,0 +1,303 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Param declares a parameter of a Function.
+type Param struct {
+	Name     string
+	Type     *Type
+	Optional bool // may be omitted; only trailing parameters can be optional
+
+	check   func(*Type) bool // overrides Type, for builtins like len
+	pattern bool             // a regular expression, compiled ahead of time if it is a literal
+}
+
+// admits reports whether an argument of type t may be passed for p.
+func (p Param) admits(t *Type) bool {
+	switch {
+	case p.check != nil:
+		return p.check(t)
+	case p.Type == nil:
+		return true
+	}
+	return assignable(t, p.Type)
+}
+
+// Function is a function callable from expressions. Its arguments are
+// evaluated before the call, and the call is checked against Params when
+// the expression is parsed.
+type Function struct {
+	Name     string
+	Params   []Param
+	Variadic bool // the last parameter may be repeated any number of times
+	Result   *Type
+	Call     func(args []interface{}) (interface{}, error)
+	Pure     bool // the result depends on the arguments only, so calls with constant arguments may be folded
+
+	form form
+}
+
+// form tells how the arguments of a call are evaluated.
+type form uint8
+
+const (
+	plain       form = iota // all arguments, before the call
+	definedForm             // defined(path): probe the path
+	defaultForm             // default(path, fallback): probe the path, then maybe evaluate fallback
+	allForm                 // all(array, pred): evaluate pred for each element, see iterator
+	anyForm
+	noneForm
+	countForm
+	filterForm
+	mapForm
+)
+
+// probes reports whether the first argument of calls in form f is a path
+// that is probed rather than evaluated.
+func (f form) probes() bool {
+	return f == definedForm || f == defaultForm
+}
+
+// lambda reports whether the second argument of calls in form f is a
+// predicate, evaluated once per element of the first with # bound to it.
+func (f form) lambda() bool {
+	return f >= allForm
+}
+
+// arity returns the least and the most number of arguments f takes;
+// max is -1 for variadic functions.
+func (f *Function) arity() (min, max int) {
+	for i, p := range f.Params {
+		if !p.Optional && !(f.Variadic && i == len(f.Params)-1) {
+			min++
+		}
+	}
+	if f.Variadic {
+		return min, -1
+	}
+	return min, len(f.Params)
+}
+
+// param returns the parameter that receives argument i.
+func (f *Function) param(i int) Param {
+	if len(f.Params) == 0 {
+		return Param{}
+	}
+	if i >= len(f.Params) {
+		return f.Params[len(f.Params)-1]
+	}
+	return f.Params[i]
+}
+
+// call calls f, raising its error as an *EvalError.
+func (f *Function) call(args []interface{}) interface{} {
+	v, err := f.Call(args)
+	if err != nil {
+		var e *EvalError
+		if !errors.As(err, &e) {
+			e = &EvalError{Types: typesOf(args), Msg: err.Error(), Err: err}
+		}
+		if e.Func == "" {
+			e.Func = f.Name
+		}
+		panic(e)
+	}
+	return v
+}
+
+// Functions is a set of functions by name. Parse resolves calls against
+// the builtins unless it is given another set with WithFunctions.
+type Functions map[string]*Function
+
+// Builtins returns a new set holding copies of the builtin functions, for
+// callers to extend, override, trim or change.
+func Builtins() Functions {
+	fs := make(Functions, len(builtins))
+	for name, f := range builtins {
+		g := *f
+		g.Params = append([]Param(nil), f.Params...)
+		fs[name] = &g
+	}
+	return fs
+}
+
+// Add adds f to the set, replacing any function of the same name.
+func (fs Functions) Add(f *Function) {
+	fs[f.Name] = f
+}
+
+// Remove removes the function name from the set.
+func (fs Functions) Remove(name string) {
+	delete(fs, name)
+}
+
+// Register adds the Go function fn under name. Its signature is derived
+// from the type of fn, which must return one value, optionally followed by
+// an error. Parameters and results may be bools, numbers, strings, slices,
+// maps with string keys and interface{}; a variadic fn is variadic.
+func (fs Functions) Register(name string, fn interface{}) error {
+	f, err := adapt(name, fn)
+	if err != nil {
+		return err
+	}
+	fs.Add(f)
+	return nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func adapt(name string, fn interface{}) (*Function, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("register %s: %T is not a function", name, fn)
+	}
+	if t.NumOut() == 0 || t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != errorType {
+		return nil, fmt.Errorf("register %s: %s must return a value and optionally an error", name, t)
+	}
+
+	f := &Function{Name: name, Variadic: t.IsVariadic()}
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
+		if f.Variadic && i == len(in)-1 {
+			in[i] = in[i].Elem()
+		}
+		pt, ok := typeOf(in[i])
+		if !ok {
+			return nil, fmt.Errorf("register %s: unsupported parameter type %s", name, in[i])
+		}
+		f.Params = append(f.Params, Param{Name: fmt.Sprintf("p%d", i), Type: pt})
+	}
+	if f.Result, _ = typeOf(t.Out(0)); f.Result == nil {
+		return nil, fmt.Errorf("register %s: unsupported result type %s", name, t.Out(0))
+	}
+
+	f.Call = func(args []interface{}) (interface{}, error) {
+		vals := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			pt := in[len(in)-1]
+			if i < len(in) {
+				pt = in[i]
+			}
+			x, ok := convertTo(arg, pt)
+			if !ok {
+				return nil, argError(name, args...)
+			}
+			vals[i] = x
+		}
+		out := v.Call(vals)
+		if len(out) == 2 && !out[1].IsNil() {
+			return nil, out[1].Interface().(error)
+		}
+		return normalize(out[0].Interface()), nil
+	}
+	return f, nil
+}
+
+// typeOf returns the static type of values of the Go type t.
+func typeOf(t reflect.Type) (*Type, bool) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return BoolType, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return IntType, true
+	case reflect.Float32, reflect.Float64:
+		return FloatType, true
+	case reflect.String:
+		return StringType, true
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return AnyType, true
+		}
+	case reflect.Slice, reflect.Array:
+		if elem, ok := typeOf(t.Elem()); ok {
+			return ArrayOf(elem), true
+		}
+	case reflect.Map:
+		if elem, ok := typeOf(t.Elem()); ok && t.Key().Kind() == reflect.String {
+			return MapOf(elem), true
+		}
+	}
+	return nil, false
+}
+
+// convertTo converts an expression value to the Go type t.
+func convertTo(v interface{}, t reflect.Type) (reflect.Value, bool) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Slice, reflect.Map, reflect.Ptr:
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+	r := reflect.ValueOf(v)
+	if r.Type().AssignableTo(t) {
+		return r, true
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, ok := toInt(v); ok {
+			return reflect.ValueOf(i).Convert(t), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := num2float64(v); ok {
+			return reflect.ValueOf(f).Convert(t), true
+		}
+	case reflect.String:
+		if r.Kind() == reflect.String {
+			return r.Convert(t), true
+		}
+	case reflect.Slice:
+		if isList(r.Kind()) {
+			s := reflect.MakeSlice(t, r.Len(), r.Len())
+			for i := 0; i < r.Len(); i++ {
+				x, ok := convertTo(r.Index(i).Interface(), t.Elem())
+				if !ok {
+					return reflect.Value{}, false
+				}
+				s.Index(i).Set(x)
+			}
+			return s, true
+		}
+	case reflect.Map:
+		if r.Kind() == reflect.Map {
+			m := reflect.MakeMapWithSize(t, r.Len())
+			iter := r.MapRange()
+			for iter.Next() {
+				k, ok := convertTo(iter.Key().Interface(), t.Key())
+				if !ok {
+					return reflect.Value{}, false
+				}
+				x, ok := convertTo(iter.Value().Interface(), t.Elem())
+				if !ok {
+					return reflect.Value{}, false
+				}
+				m.SetMapIndex(k, x)
+			}
+			return m, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// normalize converts the result of a Go function to the types produced by
+// literals: integers become int64 and floats become float64.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int64, float64:
+		return x
+	case float32:
+		return float64(x)
+	}
+	if i, ok := toInt(v); ok {
+		return i
+	}
+	return v
+}
@@ -23,7 +23,7 @@ func main() {
 	echo(``)
 	echo(`package parser`)
 	echo(`import (`)
-	echo(`"fmt"`)
+	echo(`"math"`)
 	echo(`"reflect"`)
 	echo(`)`)
 
@@ -51,7 +51,7 @@ func main() {
 					return x || y
 				}
 			}
-			panic(fmt.Sprintf("invalid operation: %!T(MISSING) %!v(MISSING) %!T(MISSING)", a, "&&", b))
+			panic(opError("||", a, b))
 		}
 		
 		func and(a, b interface{}) interface{} {
@@ -62,7 +62,7 @@ func main() {
 					return x && y
 				}
 			}
-			panic(fmt.Sprintf("invalid operation: %!T(MISSING) %!v(MISSING) %!T(MISSING)", a, "&&", b))
+			panic(opError("&&", a, b))
 		}
 		
 		func not(a interface{}) interface{} {
@@ -70,7 +70,7 @@ func main() {
 			case bool:
 				return !x
 			}
-			panic(fmt.Sprintf("invalid operation: %!v(MISSING) %!T(MISSING)", "!", a))
+			panic(opError("!", a))
 		}
 		
 		func ne(a, b interface{}) interface{} {
@@ -79,8 +79,8 @@ func main() {
 	`)
 
 	helpers := []struct {
-		name, op        string
-		noFloat, string bool
+		name, op                             string
+		noFloat, string, order, shift, power bool
 	}{
 		{
 			name:   "eq",
@@ -91,21 +91,25 @@ func main() {
 			name:   "lt",
 			op:     "<",
 			string: true,
+			order:  true,
 		},
 		{
 			name:   "gt",
 			op:     ">",
 			string: true,
+			order:  true,
 		},
 		{
 			name:   "le",
 			op:     "<=",
 			string: true,
+			order:  true,
 		},
 		{
 			name:   "ge",
 			op:     ">=",
 			string: true,
+			order:  true,
 		},
 		{
 			name:   "add",
@@ -129,6 +133,47 @@ func main() {
 			op:      "%",
 			noFloat: true,
 		},
+		{
+			name:    "bitAnd",
+			op:      "&",
+			noFloat: true,
+		},
+		{
+			name:    "bitOr",
+			op:      "|",
+			noFloat: true,
+		},
+		{
+			name:    "bitXor",
+			op:      "^",
+			noFloat: true,
+		},
+		{
+			name:    "bitClear",
+			op:      "&^",
+			noFloat: true,
+		},
+		{
+			// the count of a shift may be of any integer type, and the
+			// result is of the type of the shifted operand
+			name:    "shl",
+			op:      "<<",
+			noFloat: true,
+			shift:   true,
+		},
+		{
+			name:    "shr",
+			op:      ">>",
+			noFloat: true,
+			shift:   true,
+		},
+		{
+			// integers raised to a non-negative integer power stay
+			// integers, which wrap around like products do
+			name:  "power",
+			op:    "**",
+			power: true,
+		},
 	}
 
 	for _, helper := range helpers {
@@ -147,6 +192,34 @@ func main() {
 					continue
 				}
 				echo(`case %v:`, b)
+				if helper.power {
+					// the operands are converted like for the other
+					// operators, to the type later in types
+					tp := a
+					if j > i {
+						tp = b
+					}
+					if strings.HasPrefix(tp, "float") {
+						echo(`return %v(math.Pow(float64(x), float64(y)))`, tp)
+						continue
+					}
+					if !strings.HasPrefix(b, "uint") {
+						echo(`if y < 0 {`)
+						echo(`return math.Pow(float64(x), float64(y))`)
+						echo(`}`)
+					}
+					echo(`return pow%v(%v(x), %v(y))`, strings.ToUpper(tp[:1])+tp[1:], tp, tp)
+					continue
+				}
+				if helper.shift {
+					if !strings.HasPrefix(b, "uint") {
+						echo(`if y < 0 {`)
+						echo(`panic(shiftError("%v", a, b))`, op)
+						echo(`}`)
+					}
+					echo(`return x %v y`, op)
+					continue
+				}
 				if i == j {
 					echo(`return x %v y`, op)
 				}
@@ -166,16 +239,53 @@ func main() {
 			echo(`}`)
 		}
 		echo(`}`)
-		if name == "eq" {
-			echo(`if isNil(a) && isNil(b) { return true }`)
-			echo(`return reflect.DeepEqual(a, b)`)
-		} else {
-			echo(`panic(fmt.Sprintf("invalid operation: %%T %%v %%T", a, "%v", b))`, op)
+		switch {
+		case name == "eq":
+			echo(`return equal(a, b)`)
+		case helper.order:
+			// ordering against null is false, never an error
+			echo(`if isNil(a) || isNil(b) {`)
+			echo(`return false`)
+			echo(`}`)
+			echo(`panic(opError("%v", a, b))`, op)
+		default:
+			echo(`panic(opError("%v", a, b))`, op)
 		}
 		echo(`}`)
 		echo(``)
 	}
 
+	for _, tp := range types {
+		if strings.HasPrefix(tp, "float") {
+			continue
+		}
+		echo(`func pow%v(x, y %v) %v {`, strings.ToUpper(tp[:1])+tp[1:], tp, tp)
+		echo(`r := %v(1)`, tp)
+		echo(`for ; y > 0; y >>= 1 {`)
+		echo(`if y&1 == 1 {`)
+		echo(`r *= x`)
+		echo(`}`)
+		echo(`x *= x`)
+		echo(`}`)
+		echo(`return r`)
+		echo(`}`)
+		echo(``)
+	}
+
+	echo(`func bitNot(a interface{}) interface{} {`)
+	echo(`switch x := a.(type) {`)
+	for _, tp := range types {
+		if strings.HasPrefix(tp, "float") {
+			continue
+		}
+		echo(`case %v:`, tp)
+		echo(`return ^x`)
+	}
+	echo(`}`)
+	echo(`panic(opError("^", a))`)
+	echo(`}`)
+	echo(``)
+
 	echo(`
 		func isNil(v interface{}) bool {
 			if v == nil {
@@ -3,7 +3,7 @@
 package parser
 
 import (
-	"fmt"
+	"math"
 	"reflect"
 )
 
@@ -15,7 +15,7 @@ func or(a, b interface{}) interface{} {
 			return x || y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %!!(MISSING)T(MISSING) %!!(MISSING)v(MISSING) %!!(MISSING)T(MISSING)", a, "&&", b))
+	panic(opError("||", a, b))
 }
 
 func and(a, b interface{}) interface{} {
@@ -26,7 +26,7 @@ func and(a, b interface{}) interface{} {
 			return x && y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %!!(MISSING)T(MISSING) %!!(MISSING)v(MISSING) %!!(MISSING)T(MISSING)", a, "&&", b))
+	panic(opError("&&", a, b))
 }
 
 func not(a interface{}) interface{} {
@@ -34,7 +34,7 @@ func not(a interface{}) interface{} {
 	case bool:
 		return !x
 	}
-	panic(fmt.Sprintf("invalid operation: %!!(MISSING)v(MISSING) %!!(MISSING)T(MISSING)", "!", a))
+	panic(opError("!", a))
 }
 
 func ne(a, b interface{}) interface{} {
@@ -373,10 +373,7 @@ func eq(a, b interface{}) interface{} {
 			return x == y
 		}
 	}
-	if isNil(a) && isNil(b) {
-		return true
-	}
-	return reflect.DeepEqual(a, b)
+	return equal(a, b)
 }
 
 func lt(a, b interface{}) interface{} {
@@ -711,7 +708,10 @@ func lt(a, b interface{}) interface{} {
 			return x < y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "<", b))
+	if isNil(a) || isNil(b) {
+		return false
+	}
+	panic(opError("<", a, b))
 }
 
 func gt(a, b interface{}) interface{} {
@@ -1046,7 +1046,10 @@ func gt(a, b interface{}) interface{} {
 			return x > y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, ">", b))
+	if isNil(a) || isNil(b) {
+		return false
+	}
+	panic(opError(">", a, b))
 }
 
 func le(a, b interface{}) interface{} {
@@ -1381,7 +1384,10 @@ func le(a, b interface{}) interface{} {
 			return x <= y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "<=", b))
+	if isNil(a) || isNil(b) {
+		return false
+	}
+	panic(opError("<=", a, b))
 }
 
 func ge(a, b interface{}) interface{} {
@@ -1716,7 +1722,10 @@ func ge(a, b interface{}) interface{} {
 			return x >= y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, ">=", b))
+	if isNil(a) || isNil(b) {
+		return false
+	}
+	panic(opError(">=", a, b))
 }
 
 func add(a, b interface{}) interface{} {
@@ -2051,7 +2060,7 @@ func add(a, b interface{}) interface{} {
 			return x + y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "+", b))
+	panic(opError("+", a, b))
 }
 
 func sub(a, b interface{}) interface{} {
@@ -2381,7 +2390,7 @@ func sub(a, b interface{}) interface{} {
 			return x - y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "-", b))
+	panic(opError("-", a, b))
 }
 
 func mul(a, b interface{}) interface{} {
@@ -2711,7 +2720,7 @@ func mul(a, b interface{}) interface{} {
 			return x * y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "*", b))
+	panic(opError("*", a, b))
 }
 
 func div(a, b interface{}) interface{} {
@@ -3041,7 +3050,7 @@ func div(a, b interface{}) interface{} {
 			return x / y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "/", b))
+	panic(opError("/", a, b))
 }
 
 func mod(a, b interface{}) interface{} {
@@ -3277,7 +3286,2339 @@ func mod(a, b interface{}) interface{} {
 			return x % y
 		}
 	}
-	panic(fmt.Sprintf("invalid operation: %T %v %T", a, "%", b))
+	panic(opError("%", a, b))
+}
+
+func bitAnd(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x & y
+		case uint8:
+			return uint8(x) & y
+		case uint16:
+			return uint16(x) & y
+		case uint32:
+			return uint32(x) & y
+		case uint64:
+			return uint64(x) & y
+		case int:
+			return int(x) & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x & uint8(y)
+		case uint8:
+			return x & y
+		case uint16:
+			return uint16(x) & y
+		case uint32:
+			return uint32(x) & y
+		case uint64:
+			return uint64(x) & y
+		case int:
+			return int(x) & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x & uint16(y)
+		case uint8:
+			return x & uint16(y)
+		case uint16:
+			return x & y
+		case uint32:
+			return uint32(x) & y
+		case uint64:
+			return uint64(x) & y
+		case int:
+			return int(x) & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x & uint32(y)
+		case uint8:
+			return x & uint32(y)
+		case uint16:
+			return x & uint32(y)
+		case uint32:
+			return x & y
+		case uint64:
+			return uint64(x) & y
+		case int:
+			return int(x) & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x & uint64(y)
+		case uint8:
+			return x & uint64(y)
+		case uint16:
+			return x & uint64(y)
+		case uint32:
+			return x & uint64(y)
+		case uint64:
+			return x & y
+		case int:
+			return int(x) & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x & int(y)
+		case uint8:
+			return x & int(y)
+		case uint16:
+			return x & int(y)
+		case uint32:
+			return x & int(y)
+		case uint64:
+			return x & int(y)
+		case int:
+			return x & y
+		case int8:
+			return int8(x) & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x & int8(y)
+		case uint8:
+			return x & int8(y)
+		case uint16:
+			return x & int8(y)
+		case uint32:
+			return x & int8(y)
+		case uint64:
+			return x & int8(y)
+		case int:
+			return x & int8(y)
+		case int8:
+			return x & y
+		case int16:
+			return int16(x) & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x & int16(y)
+		case uint8:
+			return x & int16(y)
+		case uint16:
+			return x & int16(y)
+		case uint32:
+			return x & int16(y)
+		case uint64:
+			return x & int16(y)
+		case int:
+			return x & int16(y)
+		case int8:
+			return x & int16(y)
+		case int16:
+			return x & y
+		case int32:
+			return int32(x) & y
+		case int64:
+			return int64(x) & y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x & int32(y)
+		case uint8:
+			return x & int32(y)
+		case uint16:
+			return x & int32(y)
+		case uint32:
+			return x & int32(y)
+		case uint64:
+			return x & int32(y)
+		case int:
+			return x & int32(y)
+		case int8:
+			return x & int32(y)
+		case int16:
+			return x & int32(y)
+		case int32:
+			return x & y
+		case int64:
+			return int64(x) & y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x & int64(y)
+		case uint8:
+			return x & int64(y)
+		case uint16:
+			return x & int64(y)
+		case uint32:
+			return x & int64(y)
+		case uint64:
+			return x & int64(y)
+		case int:
+			return x & int64(y)
+		case int8:
+			return x & int64(y)
+		case int16:
+			return x & int64(y)
+		case int32:
+			return x & int64(y)
+		case int64:
+			return x & y
+		}
+	}
+	panic(opError("&", a, b))
+}
+
+func bitOr(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x | y
+		case uint8:
+			return uint8(x) | y
+		case uint16:
+			return uint16(x) | y
+		case uint32:
+			return uint32(x) | y
+		case uint64:
+			return uint64(x) | y
+		case int:
+			return int(x) | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x | uint8(y)
+		case uint8:
+			return x | y
+		case uint16:
+			return uint16(x) | y
+		case uint32:
+			return uint32(x) | y
+		case uint64:
+			return uint64(x) | y
+		case int:
+			return int(x) | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x | uint16(y)
+		case uint8:
+			return x | uint16(y)
+		case uint16:
+			return x | y
+		case uint32:
+			return uint32(x) | y
+		case uint64:
+			return uint64(x) | y
+		case int:
+			return int(x) | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x | uint32(y)
+		case uint8:
+			return x | uint32(y)
+		case uint16:
+			return x | uint32(y)
+		case uint32:
+			return x | y
+		case uint64:
+			return uint64(x) | y
+		case int:
+			return int(x) | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x | uint64(y)
+		case uint8:
+			return x | uint64(y)
+		case uint16:
+			return x | uint64(y)
+		case uint32:
+			return x | uint64(y)
+		case uint64:
+			return x | y
+		case int:
+			return int(x) | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x | int(y)
+		case uint8:
+			return x | int(y)
+		case uint16:
+			return x | int(y)
+		case uint32:
+			return x | int(y)
+		case uint64:
+			return x | int(y)
+		case int:
+			return x | y
+		case int8:
+			return int8(x) | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x | int8(y)
+		case uint8:
+			return x | int8(y)
+		case uint16:
+			return x | int8(y)
+		case uint32:
+			return x | int8(y)
+		case uint64:
+			return x | int8(y)
+		case int:
+			return x | int8(y)
+		case int8:
+			return x | y
+		case int16:
+			return int16(x) | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x | int16(y)
+		case uint8:
+			return x | int16(y)
+		case uint16:
+			return x | int16(y)
+		case uint32:
+			return x | int16(y)
+		case uint64:
+			return x | int16(y)
+		case int:
+			return x | int16(y)
+		case int8:
+			return x | int16(y)
+		case int16:
+			return x | y
+		case int32:
+			return int32(x) | y
+		case int64:
+			return int64(x) | y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x | int32(y)
+		case uint8:
+			return x | int32(y)
+		case uint16:
+			return x | int32(y)
+		case uint32:
+			return x | int32(y)
+		case uint64:
+			return x | int32(y)
+		case int:
+			return x | int32(y)
+		case int8:
+			return x | int32(y)
+		case int16:
+			return x | int32(y)
+		case int32:
+			return x | y
+		case int64:
+			return int64(x) | y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x | int64(y)
+		case uint8:
+			return x | int64(y)
+		case uint16:
+			return x | int64(y)
+		case uint32:
+			return x | int64(y)
+		case uint64:
+			return x | int64(y)
+		case int:
+			return x | int64(y)
+		case int8:
+			return x | int64(y)
+		case int16:
+			return x | int64(y)
+		case int32:
+			return x | int64(y)
+		case int64:
+			return x | y
+		}
+	}
+	panic(opError("|", a, b))
+}
+
+func bitXor(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x ^ y
+		case uint8:
+			return uint8(x) ^ y
+		case uint16:
+			return uint16(x) ^ y
+		case uint32:
+			return uint32(x) ^ y
+		case uint64:
+			return uint64(x) ^ y
+		case int:
+			return int(x) ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x ^ uint8(y)
+		case uint8:
+			return x ^ y
+		case uint16:
+			return uint16(x) ^ y
+		case uint32:
+			return uint32(x) ^ y
+		case uint64:
+			return uint64(x) ^ y
+		case int:
+			return int(x) ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x ^ uint16(y)
+		case uint8:
+			return x ^ uint16(y)
+		case uint16:
+			return x ^ y
+		case uint32:
+			return uint32(x) ^ y
+		case uint64:
+			return uint64(x) ^ y
+		case int:
+			return int(x) ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x ^ uint32(y)
+		case uint8:
+			return x ^ uint32(y)
+		case uint16:
+			return x ^ uint32(y)
+		case uint32:
+			return x ^ y
+		case uint64:
+			return uint64(x) ^ y
+		case int:
+			return int(x) ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x ^ uint64(y)
+		case uint8:
+			return x ^ uint64(y)
+		case uint16:
+			return x ^ uint64(y)
+		case uint32:
+			return x ^ uint64(y)
+		case uint64:
+			return x ^ y
+		case int:
+			return int(x) ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x ^ int(y)
+		case uint8:
+			return x ^ int(y)
+		case uint16:
+			return x ^ int(y)
+		case uint32:
+			return x ^ int(y)
+		case uint64:
+			return x ^ int(y)
+		case int:
+			return x ^ y
+		case int8:
+			return int8(x) ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x ^ int8(y)
+		case uint8:
+			return x ^ int8(y)
+		case uint16:
+			return x ^ int8(y)
+		case uint32:
+			return x ^ int8(y)
+		case uint64:
+			return x ^ int8(y)
+		case int:
+			return x ^ int8(y)
+		case int8:
+			return x ^ y
+		case int16:
+			return int16(x) ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x ^ int16(y)
+		case uint8:
+			return x ^ int16(y)
+		case uint16:
+			return x ^ int16(y)
+		case uint32:
+			return x ^ int16(y)
+		case uint64:
+			return x ^ int16(y)
+		case int:
+			return x ^ int16(y)
+		case int8:
+			return x ^ int16(y)
+		case int16:
+			return x ^ y
+		case int32:
+			return int32(x) ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x ^ int32(y)
+		case uint8:
+			return x ^ int32(y)
+		case uint16:
+			return x ^ int32(y)
+		case uint32:
+			return x ^ int32(y)
+		case uint64:
+			return x ^ int32(y)
+		case int:
+			return x ^ int32(y)
+		case int8:
+			return x ^ int32(y)
+		case int16:
+			return x ^ int32(y)
+		case int32:
+			return x ^ y
+		case int64:
+			return int64(x) ^ y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x ^ int64(y)
+		case uint8:
+			return x ^ int64(y)
+		case uint16:
+			return x ^ int64(y)
+		case uint32:
+			return x ^ int64(y)
+		case uint64:
+			return x ^ int64(y)
+		case int:
+			return x ^ int64(y)
+		case int8:
+			return x ^ int64(y)
+		case int16:
+			return x ^ int64(y)
+		case int32:
+			return x ^ int64(y)
+		case int64:
+			return x ^ y
+		}
+	}
+	panic(opError("^", a, b))
+}
+
+func bitClear(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x &^ y
+		case uint8:
+			return uint8(x) &^ y
+		case uint16:
+			return uint16(x) &^ y
+		case uint32:
+			return uint32(x) &^ y
+		case uint64:
+			return uint64(x) &^ y
+		case int:
+			return int(x) &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x &^ uint8(y)
+		case uint8:
+			return x &^ y
+		case uint16:
+			return uint16(x) &^ y
+		case uint32:
+			return uint32(x) &^ y
+		case uint64:
+			return uint64(x) &^ y
+		case int:
+			return int(x) &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x &^ uint16(y)
+		case uint8:
+			return x &^ uint16(y)
+		case uint16:
+			return x &^ y
+		case uint32:
+			return uint32(x) &^ y
+		case uint64:
+			return uint64(x) &^ y
+		case int:
+			return int(x) &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x &^ uint32(y)
+		case uint8:
+			return x &^ uint32(y)
+		case uint16:
+			return x &^ uint32(y)
+		case uint32:
+			return x &^ y
+		case uint64:
+			return uint64(x) &^ y
+		case int:
+			return int(x) &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x &^ uint64(y)
+		case uint8:
+			return x &^ uint64(y)
+		case uint16:
+			return x &^ uint64(y)
+		case uint32:
+			return x &^ uint64(y)
+		case uint64:
+			return x &^ y
+		case int:
+			return int(x) &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x &^ int(y)
+		case uint8:
+			return x &^ int(y)
+		case uint16:
+			return x &^ int(y)
+		case uint32:
+			return x &^ int(y)
+		case uint64:
+			return x &^ int(y)
+		case int:
+			return x &^ y
+		case int8:
+			return int8(x) &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x &^ int8(y)
+		case uint8:
+			return x &^ int8(y)
+		case uint16:
+			return x &^ int8(y)
+		case uint32:
+			return x &^ int8(y)
+		case uint64:
+			return x &^ int8(y)
+		case int:
+			return x &^ int8(y)
+		case int8:
+			return x &^ y
+		case int16:
+			return int16(x) &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x &^ int16(y)
+		case uint8:
+			return x &^ int16(y)
+		case uint16:
+			return x &^ int16(y)
+		case uint32:
+			return x &^ int16(y)
+		case uint64:
+			return x &^ int16(y)
+		case int:
+			return x &^ int16(y)
+		case int8:
+			return x &^ int16(y)
+		case int16:
+			return x &^ y
+		case int32:
+			return int32(x) &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x &^ int32(y)
+		case uint8:
+			return x &^ int32(y)
+		case uint16:
+			return x &^ int32(y)
+		case uint32:
+			return x &^ int32(y)
+		case uint64:
+			return x &^ int32(y)
+		case int:
+			return x &^ int32(y)
+		case int8:
+			return x &^ int32(y)
+		case int16:
+			return x &^ int32(y)
+		case int32:
+			return x &^ y
+		case int64:
+			return int64(x) &^ y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x &^ int64(y)
+		case uint8:
+			return x &^ int64(y)
+		case uint16:
+			return x &^ int64(y)
+		case uint32:
+			return x &^ int64(y)
+		case uint64:
+			return x &^ int64(y)
+		case int:
+			return x &^ int64(y)
+		case int8:
+			return x &^ int64(y)
+		case int16:
+			return x &^ int64(y)
+		case int32:
+			return x &^ int64(y)
+		case int64:
+			return x &^ y
+		}
+	}
+	panic(opError("&^", a, b))
+}
+
+func shl(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x << y
+		case uint8:
+			return x << y
+		case uint16:
+			return x << y
+		case uint32:
+			return x << y
+		case uint64:
+			return x << y
+		case int:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int8:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int16:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int32:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		case int64:
+			if y < 0 {
+				panic(shiftError("<<", a, b))
+			}
+			return x << y
+		}
+	}
+	panic(opError("<<", a, b))
+}
+
+func shr(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return x >> y
+		case uint8:
+			return x >> y
+		case uint16:
+			return x >> y
+		case uint32:
+			return x >> y
+		case uint64:
+			return x >> y
+		case int:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int8:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int16:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int32:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		case int64:
+			if y < 0 {
+				panic(shiftError(">>", a, b))
+			}
+			return x >> y
+		}
+	}
+	panic(opError(">>", a, b))
+}
+
+func power(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		switch y := b.(type) {
+		case uint:
+			return powUint(uint(x), uint(y))
+		case uint8:
+			return powUint8(uint8(x), uint8(y))
+		case uint16:
+			return powUint16(uint16(x), uint16(y))
+		case uint32:
+			return powUint32(uint32(x), uint32(y))
+		case uint64:
+			return powUint64(uint64(x), uint64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case uint8:
+		switch y := b.(type) {
+		case uint:
+			return powUint8(uint8(x), uint8(y))
+		case uint8:
+			return powUint8(uint8(x), uint8(y))
+		case uint16:
+			return powUint16(uint16(x), uint16(y))
+		case uint32:
+			return powUint32(uint32(x), uint32(y))
+		case uint64:
+			return powUint64(uint64(x), uint64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case uint16:
+		switch y := b.(type) {
+		case uint:
+			return powUint16(uint16(x), uint16(y))
+		case uint8:
+			return powUint16(uint16(x), uint16(y))
+		case uint16:
+			return powUint16(uint16(x), uint16(y))
+		case uint32:
+			return powUint32(uint32(x), uint32(y))
+		case uint64:
+			return powUint64(uint64(x), uint64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case uint32:
+		switch y := b.(type) {
+		case uint:
+			return powUint32(uint32(x), uint32(y))
+		case uint8:
+			return powUint32(uint32(x), uint32(y))
+		case uint16:
+			return powUint32(uint32(x), uint32(y))
+		case uint32:
+			return powUint32(uint32(x), uint32(y))
+		case uint64:
+			return powUint64(uint64(x), uint64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case uint64:
+		switch y := b.(type) {
+		case uint:
+			return powUint64(uint64(x), uint64(y))
+		case uint8:
+			return powUint64(uint64(x), uint64(y))
+		case uint16:
+			return powUint64(uint64(x), uint64(y))
+		case uint32:
+			return powUint64(uint64(x), uint64(y))
+		case uint64:
+			return powUint64(uint64(x), uint64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case int:
+		switch y := b.(type) {
+		case uint:
+			return powInt(int(x), int(y))
+		case uint8:
+			return powInt(int(x), int(y))
+		case uint16:
+			return powInt(int(x), int(y))
+		case uint32:
+			return powInt(int(x), int(y))
+		case uint64:
+			return powInt(int(x), int(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt(int(x), int(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case int8:
+		switch y := b.(type) {
+		case uint:
+			return powInt8(int8(x), int8(y))
+		case uint8:
+			return powInt8(int8(x), int8(y))
+		case uint16:
+			return powInt8(int8(x), int8(y))
+		case uint32:
+			return powInt8(int8(x), int8(y))
+		case uint64:
+			return powInt8(int8(x), int8(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt8(int8(x), int8(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case int16:
+		switch y := b.(type) {
+		case uint:
+			return powInt16(int16(x), int16(y))
+		case uint8:
+			return powInt16(int16(x), int16(y))
+		case uint16:
+			return powInt16(int16(x), int16(y))
+		case uint32:
+			return powInt16(int16(x), int16(y))
+		case uint64:
+			return powInt16(int16(x), int16(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt16(int16(x), int16(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case int32:
+		switch y := b.(type) {
+		case uint:
+			return powInt32(int32(x), int32(y))
+		case uint8:
+			return powInt32(int32(x), int32(y))
+		case uint16:
+			return powInt32(int32(x), int32(y))
+		case uint32:
+			return powInt32(int32(x), int32(y))
+		case uint64:
+			return powInt32(int32(x), int32(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt32(int32(x), int32(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case int64:
+		switch y := b.(type) {
+		case uint:
+			return powInt64(int64(x), int64(y))
+		case uint8:
+			return powInt64(int64(x), int64(y))
+		case uint16:
+			return powInt64(int64(x), int64(y))
+		case uint32:
+			return powInt64(int64(x), int64(y))
+		case uint64:
+			return powInt64(int64(x), int64(y))
+		case int:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case int8:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case int16:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case int32:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case int64:
+			if y < 0 {
+				return math.Pow(float64(x), float64(y))
+			}
+			return powInt64(int64(x), int64(y))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case float32:
+		switch y := b.(type) {
+		case uint:
+			return float32(math.Pow(float64(x), float64(y)))
+		case uint8:
+			return float32(math.Pow(float64(x), float64(y)))
+		case uint16:
+			return float32(math.Pow(float64(x), float64(y)))
+		case uint32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case uint64:
+			return float32(math.Pow(float64(x), float64(y)))
+		case int:
+			return float32(math.Pow(float64(x), float64(y)))
+		case int8:
+			return float32(math.Pow(float64(x), float64(y)))
+		case int16:
+			return float32(math.Pow(float64(x), float64(y)))
+		case int32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case int64:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float32:
+			return float32(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	case float64:
+		switch y := b.(type) {
+		case uint:
+			return float64(math.Pow(float64(x), float64(y)))
+		case uint8:
+			return float64(math.Pow(float64(x), float64(y)))
+		case uint16:
+			return float64(math.Pow(float64(x), float64(y)))
+		case uint32:
+			return float64(math.Pow(float64(x), float64(y)))
+		case uint64:
+			return float64(math.Pow(float64(x), float64(y)))
+		case int:
+			return float64(math.Pow(float64(x), float64(y)))
+		case int8:
+			return float64(math.Pow(float64(x), float64(y)))
+		case int16:
+			return float64(math.Pow(float64(x), float64(y)))
+		case int32:
+			return float64(math.Pow(float64(x), float64(y)))
+		case int64:
+			return float64(math.Pow(float64(x), float64(y)))
+		case float32:
+			return float64(math.Pow(float64(x), float64(y)))
+		case float64:
+			return float64(math.Pow(float64(x), float64(y)))
+		}
+	}
+	panic(opError("**", a, b))
+}
+
+func powUint(x, y uint) uint {
+	r := uint(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powUint8(x, y uint8) uint8 {
+	r := uint8(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powUint16(x, y uint16) uint16 {
+	r := uint16(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powUint32(x, y uint32) uint32 {
+	r := uint32(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powUint64(x, y uint64) uint64 {
+	r := uint64(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powInt(x, y int) int {
+	r := int(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powInt8(x, y int8) int8 {
+	r := int8(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powInt16(x, y int16) int16 {
+	r := int16(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powInt32(x, y int32) int32 {
+	r := int32(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func powInt64(x, y int64) int64 {
+	r := int64(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			r *= x
+		}
+		x *= x
+	}
+	return r
+}
+
+func bitNot(a interface{}) interface{} {
+	switch x := a.(type) {
+	case uint:
+		return ^x
+	case uint8:
+		return ^x
+	case uint16:
+		return ^x
+	case uint32:
+		return ^x
+	case uint64:
+		return ^x
+	case int:
+		return ^x
+	case int8:
+		return ^x
+	case int16:
+		return ^x
+	case int32:
+		return ^x
+	case int64:
+		return ^x
+	}
+	panic(opError("^", a))
 }
 
 func isNil(v interface{}) bool {
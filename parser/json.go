@@ -0,0 +1,609 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode"
+
+	"github.com/Cauchy-NY/eval/lexer"
+)
+
+// JSONVersion is the version of the JSON encoding of nodes written by
+// MarshalNode.
+//
+// A node is encoded as an object whose "type" tells its kind and which
+// other fields it has:
+//
+//	{"type": "ident", "name": "x"}
+//	{"type": "int", "value": 1}
+//	{"type": "float", "value": 1.5}
+//	{"type": "bool", "value": true}
+//	{"type": "string", "value": "abc"}
+//	{"type": "null"}
+//	{"type": "elem"}
+//	{"type": "unary", "op": "!", "x": node}
+//	{"type": "binary", "op": "&&", "x": node, "y": node}
+//	{"type": "cond", "cond": node, "x": node, "y": node}
+//	{"type": "let", "name": "r", "value": node, "body": node}
+//	{"type": "local", "name": "r"}
+//	{"type": "array", "elems": [node, ...]}
+//	{"type": "map", "entries": [{"key": node, "value": node}, ...]}
+//	{"type": "call", "func": "pow", "args": [node, ...]}
+//	{"type": "member", "x": node, "name": "age", "optional": true}
+//	{"type": "index", "x": node, "index": node, "optional": true}
+//
+// Operators are in their symbolic form, as Format writes them. The
+// optional field of member accesses and indexes, for ?., may be omitted
+// when false. An elem node is #, which may only appear in the predicate
+// of a call like any, and a local node refers to the name bound by an
+// enclosing let node, following the scoping rules of let. Source
+// positions are not kept: decoded nodes have empty spans.
+const JSONVersion = 1
+
+// MarshalNode encodes node as {"version": JSONVersion, "expr": node}.
+func MarshalNode(node Node) ([]byte, error) {
+	return json.Marshal(struct {
+		Version int  `json:"version"`
+		Expr    Node `json:"expr"`
+	}{JSONVersion, node})
+}
+
+// UnmarshalNode decodes a node encoded by MarshalNode. It validates the
+// tree as Parse validates source: operators must exist, names must be
+// identifiers, calls must match the functions they call, resolved against
+// the builtins or those given with WithFunctions, and map literals can't
+// repeat a constant key. Like Parse, it optimizes the tree it returns.
+// Invalid input is reported as a *DecodeError.
+func UnmarshalNode(data []byte, opts ...Option) (Node, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+		return nil, &DecodeError{Msg: "want an object, got " + describeJSON(data)}
+	}
+	for k := range doc {
+		if k != "version" && k != "expr" {
+			return nil, &DecodeError{Msg: fmt.Sprintf("unknown field %q", k)}
+		}
+	}
+	for _, k := range []string{"version", "expr"} {
+		if _, ok := doc[k]; !ok {
+			return nil, &DecodeError{Msg: fmt.Sprintf("missing field %q", k)}
+		}
+	}
+	var version int
+	if err := json.Unmarshal(doc["version"], &version); err != nil || version != JSONVersion {
+		return nil, &DecodeError{Path: "/version",
+			Msg: fmt.Sprintf("unsupported version %s, want %d", doc["version"], JSONVersion)}
+	}
+	node, err := decode(doc["expr"], "/expr", opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScopes(node, "/expr"); err != nil {
+		return nil, err
+	}
+	return Optimize(node), nil
+}
+
+// checkScopes reports a # outside of a predicate or a name used outside
+// of the let binding it in node, decoded from path.
+func checkScopes(node Node, path string) error {
+	if n := strayElem(node); n != nil {
+		return &DecodeError{Path: path, Msg: "# used outside of a predicate"}
+	}
+	if n, msg := unbound(node); n != nil {
+		return &DecodeError{Path: path, Msg: msg}
+	}
+	return nil
+}
+
+// DecodeError reports invalid JSON for a node. Path is the JSON pointer of
+// the offending value, e.g. /expr/y/args/0.
+type DecodeError struct {
+	Path string
+	Msg  string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return "decode node: " + e.Msg
+	}
+	return fmt.Sprintf("decode node: %s: %s", e.Path, e.Msg)
+}
+
+// jsonFields lists the fields of each type of node, besides "type".
+var jsonFields = map[string][]string{
+	"ident":  {"name"},
+	"int":    {"value"},
+	"float":  {"value"},
+	"bool":   {"value"},
+	"string": {"value"},
+	"null":   {},
+	"elem":   {},
+	"unary":  {"op", "x"},
+	"binary": {"op", "x", "y"},
+	"cond":   {"cond", "x", "y"},
+	"let":    {"name", "value", "body"},
+	"local":  {"name"},
+	"array":  {"elems"},
+	"map":    {"entries"},
+	"call":   {"func", "args"},
+	"member": {"x", "name", "optional"},
+	"index":  {"x", "index", "optional"},
+}
+
+type jsonEntry struct {
+	Key   Node `json:"key"`
+	Value Node `json:"value"`
+}
+
+func (n IdentNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}{"ident", n.val})
+}
+
+func (n IntNode) MarshalJSON() ([]byte, error) {
+	return marshalLiteral("int", n.val)
+}
+
+func (n FloatNode) MarshalJSON() ([]byte, error) {
+	return marshalLiteral("float", n.val)
+}
+
+func (n BoolNode) MarshalJSON() ([]byte, error) {
+	return marshalLiteral("bool", n.val)
+}
+
+func (n StringNode) MarshalJSON() ([]byte, error) {
+	return marshalLiteral("string", n.val)
+}
+
+// MarshalJSON encodes a compiled pattern as the string it was written as.
+func (n RegexNode) MarshalJSON() ([]byte, error) {
+	return marshalLiteral("string", n.Pattern())
+}
+
+func (n NullNode) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"null"}`), nil
+}
+
+func (n ElemNode) MarshalJSON() ([]byte, error) {
+	return []byte(`{"type":"elem"}`), nil
+}
+
+func marshalLiteral(typ string, v interface{}) ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+	}{typ, v})
+}
+
+func (n UnaryNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Op   string `json:"op"`
+		X    Node   `json:"x"`
+	}{"unary", n.op, n.x})
+}
+
+func (n BinaryNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Op   string `json:"op"`
+		X    Node   `json:"x"`
+		Y    Node   `json:"y"`
+	}{"binary", n.op, n.x, n.y})
+}
+
+func (n CondNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Cond Node   `json:"cond"`
+		X    Node   `json:"x"`
+		Y    Node   `json:"y"`
+	}{"cond", n.cond, n.x, n.y})
+}
+
+func (n LetNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Value Node   `json:"value"`
+		Body  Node   `json:"body"`
+	}{"let", n.name, n.value, n.body})
+}
+
+func (n LocalNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}{"local", n.name})
+}
+
+func (n ArrayNode) MarshalJSON() ([]byte, error) {
+	return marshalArray(n.args)
+}
+
+// MarshalJSON encodes a set as the array it was written as.
+func (n SetNode) MarshalJSON() ([]byte, error) {
+	return marshalArray(n.elems)
+}
+
+func marshalArray(elems []Node) ([]byte, error) {
+	if elems == nil {
+		elems = []Node{}
+	}
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Elems []Node `json:"elems"`
+	}{"array", elems})
+}
+
+func (n MapNode) MarshalJSON() ([]byte, error) {
+	entries := make([]jsonEntry, len(n.keys))
+	for i, k := range n.keys {
+		entries[i] = jsonEntry{k, n.vals[i]}
+	}
+	return json.Marshal(struct {
+		Type    string      `json:"type"`
+		Entries []jsonEntry `json:"entries"`
+	}{"map", entries})
+}
+
+func (n FuncNode) MarshalJSON() ([]byte, error) {
+	args := n.args
+	if args == nil {
+		args = []Node{}
+	}
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Func string `json:"func"`
+		Args []Node `json:"args"`
+	}{"call", n.fn, args})
+}
+
+func (n MemberNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string `json:"type"`
+		X        Node   `json:"x"`
+		Name     string `json:"name"`
+		Optional bool   `json:"optional,omitempty"`
+	}{"member", n.x, n.name, n.optional})
+}
+
+func (n IndexNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string `json:"type"`
+		X        Node   `json:"x"`
+		Index    Node   `json:"index"`
+		Optional bool   `json:"optional,omitempty"`
+	}{"index", n.x, n.index, n.optional})
+}
+
+// The UnmarshalJSON methods decode one node of their type, without a
+// version, validating it like UnmarshalNode against the builtins. They
+// don't optimize it.
+
+func (n *IdentNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+func (n *IntNode) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, n) }
+func (n *FloatNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+func (n *BoolNode) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, n) }
+func (n *NullNode) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, n) }
+func (n *ElemNode) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, n) }
+func (n *StringNode) UnmarshalJSON(data []byte) error { return unmarshalInto(data, n) }
+func (n *UnaryNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+func (n *BinaryNode) UnmarshalJSON(data []byte) error { return unmarshalInto(data, n) }
+func (n *CondNode) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, n) }
+func (n *LetNode) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, n) }
+func (n *LocalNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+func (n *ArrayNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+func (n *MapNode) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, n) }
+func (n *FuncNode) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, n) }
+func (n *MemberNode) UnmarshalJSON(data []byte) error { return unmarshalInto(data, n) }
+func (n *IndexNode) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, n) }
+
+// unmarshalInto decodes data into the node ptr points to, which must be of
+// the same type.
+func unmarshalInto(data []byte, ptr interface{}) error {
+	node, err := decode(data, "", nil)
+	if err != nil {
+		return err
+	}
+	if err := checkScopes(node, ""); err != nil {
+		return err
+	}
+	dst := reflect.ValueOf(ptr).Elem()
+	src := reflect.ValueOf(node)
+	if src.Type() != dst.Type() {
+		return &DecodeError{Msg: fmt.Sprintf("cannot decode %s node into %T", jsonType(node), ptr)}
+	}
+	dst.Set(src)
+	return nil
+}
+
+// decode decodes the node data at path.
+func decode(data []byte, path string, opts []Option) (_ Node, err error) {
+	d := &decoder{funcs: builtins}
+	for _, opt := range opts {
+		p := &Parser{funcs: d.funcs}
+		opt(p)
+		d.funcs = p.funcs
+	}
+	// data is decoded in one pass, and the nodes are read from the values,
+	// rather than each level decoding the bytes of its children again.
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, &DecodeError{Path: path, Msg: "want a node object, got invalid JSON"}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*DecodeError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return d.node(v, path), nil
+}
+
+type decoder struct {
+	funcs Functions
+}
+
+func (d *decoder) errorf(path, format string, args ...interface{}) {
+	panic(&DecodeError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (d *decoder) node(v interface{}, path string) Node {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		d.errorf(path, "want a node object, got %s", describe(v))
+	}
+	var typ string
+	d.field(fields, "type", path, &typ)
+	allowed, ok := jsonFields[typ]
+	if !ok {
+		d.errorf(path+"/type", "unknown node type %q", typ)
+	}
+	for k := range fields {
+		if k != "type" && !hasString(allowed, k) {
+			d.errorf(path+"/"+k, "unknown field %q in %s node", k, typ)
+		}
+	}
+
+	switch typ {
+	case "ident":
+		return IdentNode{val: d.name(fields, path)}
+	case "int":
+		var num json.Number
+		d.field(fields, "value", path, &num)
+		i, err := strconv.ParseInt(num.String(), 10, 64)
+		if err != nil {
+			d.errorf(path+"/value", "invalid int %s", num)
+		}
+		return IntNode{val: i}
+	case "float":
+		var num json.Number
+		d.field(fields, "value", path, &num)
+		f, err := num.Float64()
+		if err != nil {
+			d.errorf(path+"/value", "invalid float %s", num)
+		}
+		return FloatNode{val: f}
+	case "bool":
+		var b bool
+		d.field(fields, "value", path, &b)
+		return BoolNode{val: b}
+	case "string":
+		var s string
+		d.field(fields, "value", path, &s)
+		return StringNode{val: s}
+	case "null":
+		return NullNode{}
+	case "elem":
+		return ElemNode{}
+	case "unary":
+		var op string
+		d.field(fields, "op", path, &op)
+		if _, ok := unaryOps[op]; !ok {
+			d.errorf(path+"/op", "unknown unary operator %q", op)
+		}
+		return UnaryNode{op: op, x: d.child(fields, "x", path)}
+	case "binary":
+		var op string
+		d.field(fields, "op", path, &op)
+		if _, ok := binaryOps[op]; !ok && op != "&&" && op != "||" && op != "??" {
+			d.errorf(path+"/op", "unknown binary operator %q", op)
+		}
+		x, y := d.child(fields, "x", path), d.child(fields, "y", path)
+		if op == "=~" || op == "!~" {
+			if err := checkPattern(y); err != nil {
+				d.errorf(path+"/y", "%v", err)
+			}
+		}
+		return BinaryNode{op: op, x: x, y: y}
+	case "cond":
+		return CondNode{cond: d.child(fields, "cond", path), x: d.child(fields, "x", path), y: d.child(fields, "y", path)}
+	case "let":
+		name := d.name(fields, path)
+		return LetNode{name: name, value: d.child(fields, "value", path), body: d.child(fields, "body", path)}
+	case "local":
+		return LocalNode{name: d.name(fields, path)}
+	case "array":
+		return ArrayNode{args: d.list(fields, "elems", path)}
+	case "map":
+		return d.mapNode(fields, path)
+	case "call":
+		var name string
+		d.field(fields, "func", path, &name)
+		args := d.list(fields, "args", path)
+		f, err := resolveCall(d.funcs, name, args)
+		if err != nil {
+			if err.arg < 0 {
+				d.errorf(path, "%s", err.msg)
+			}
+			d.errorf(fmt.Sprintf("%s/args/%d", path, err.arg), "%s", err.msg)
+		}
+		return FuncNode{fn: name, args: args, f: f}
+	case "member":
+		name := d.name(fields, path)
+		return MemberNode{x: d.child(fields, "x", path), name: name, optional: d.optional(fields, path)}
+	case "index":
+		return IndexNode{x: d.child(fields, "x", path), index: d.child(fields, "index", path), optional: d.optional(fields, path)}
+	}
+	panic("unreachable")
+}
+
+// field stores the required field name of a node in v, a *string, *bool,
+// *json.Number or *[]interface{}.
+func (d *decoder) field(fields map[string]interface{}, name, path string, v interface{}) {
+	x, ok := fields[name]
+	if !ok {
+		d.errorf(path, "missing field %q", name)
+	}
+	switch v := v.(type) {
+	case *string:
+		*v, ok = x.(string)
+	case *bool:
+		*v, ok = x.(bool)
+	case *json.Number:
+		*v, ok = x.(json.Number)
+	case *[]interface{}:
+		*v, ok = x.([]interface{})
+	}
+	if !ok {
+		d.errorf(path+"/"+name, "invalid %s: %s", name, describe(x))
+	}
+}
+
+// name decodes the name field of a node, which must be an identifier.
+func (d *decoder) name(fields map[string]interface{}, path string) string {
+	var name string
+	d.field(fields, "name", path, &name)
+	if !isIdent(name) {
+		d.errorf(path+"/name", "invalid identifier %q", name)
+	}
+	return name
+}
+
+// optional decodes the optional field of a member access or index, false
+// if it is missing.
+func (d *decoder) optional(fields map[string]interface{}, path string) bool {
+	var b bool
+	if _, ok := fields["optional"]; ok {
+		d.field(fields, "optional", path, &b)
+	}
+	return b
+}
+
+func (d *decoder) child(fields map[string]interface{}, name, path string) Node {
+	if _, ok := fields[name]; !ok {
+		d.errorf(path, "missing field %q", name)
+	}
+	return d.node(fields[name], path+"/"+name)
+}
+
+func (d *decoder) list(fields map[string]interface{}, name, path string) []Node {
+	var elems []interface{}
+	d.field(fields, name, path, &elems)
+	nodes := make([]Node, len(elems))
+	for i, elem := range elems {
+		nodes[i] = d.node(elem, fmt.Sprintf("%s/%s/%d", path, name, i))
+	}
+	return nodes
+}
+
+func (d *decoder) mapNode(fields map[string]interface{}, path string) Node {
+	var entries []interface{}
+	d.field(fields, "entries", path, &entries)
+	var n MapNode
+	seen := make(map[interface{}]bool)
+	for i, v := range entries {
+		at := fmt.Sprintf("%s/entries/%d", path, i)
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			d.errorf(at, "want a map entry object, got %s", describe(v))
+		}
+		for k := range entry {
+			if k != "key" && k != "value" {
+				d.errorf(at+"/"+k, "unknown field %q in map entry", k)
+			}
+		}
+		key := d.child(entry, "key", at)
+		if k, ok := constKey(key); ok {
+			if seen[k] {
+				d.errorf(at+"/key", "duplicate key %v in map literal", k)
+			}
+			seen[k] = true
+		}
+		n.keys = append(n.keys, key)
+		n.vals = append(n.vals, d.child(entry, "value", at))
+	}
+	return n
+}
+
+// isIdent reports whether s reads as an identifier.
+func isIdent(s string) bool {
+	if s == "" || lexer.IsKeyword(s) {
+		return false
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// describeJSON describes a JSON value for errors.
+func describeJSON(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "invalid JSON"
+	}
+	return describe(v)
+}
+
+// describe describes a decoded JSON value for errors.
+func describe(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a bool"
+	case float64, json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	}
+	return "an object"
+}
+
+// jsonType returns the "type" of node in its encoding.
+func jsonType(node Node) string {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Sprintf("%T", node)
+	}
+	var v struct{ Type string }
+	json.Unmarshal(data, &v)
+	return v.Type
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// errLambda is returned by the plain versions of all, any, none, filter,
+// map and count: their predicate can't be evaluated ahead of the call.
+var errLambda = errors.New("the predicate must be evaluated per element; call it from an expression")
+
+func lambdaCall(args []interface{}) (interface{}, error) {
+	return nil, errLambda
+}
+
+// iterator walks the elements of the array passed to a call in a lambda
+// form and accumulates the result of the call from the values of its
+// predicate. A nil array has no elements.
+type iterator struct {
+	f       *Function
+	list    []interface{}
+	r       reflect.Value // the array, unless it is a []interface{}
+	i, n    int
+	elem    interface{}
+	decided bool // all, any or none found the element deciding the result
+	count   int64
+	res     []interface{}
+}
+
+func newIterator(f *Function, v interface{}) *iterator {
+	it := &iterator{f: f}
+	switch x := v.(type) {
+	case nil:
+	case []interface{}:
+		it.list, it.n = x, len(x)
+	default:
+		r := reflect.ValueOf(v)
+		if !isList(r.Kind()) {
+			panic(argError(f.Name, v))
+		}
+		it.r, it.n = r, r.Len()
+	}
+	return it
+}
+
+// next moves to the next element, reporting false past the last one.
+func (it *iterator) next() bool {
+	if it.i == it.n {
+		return false
+	}
+	if it.list != nil {
+		it.elem = it.list[it.i]
+	} else {
+		it.elem = it.r.Index(it.i).Interface()
+	}
+	it.i++
+	return true
+}
+
+// step takes v, the value of the predicate for the current element, and
+// reports whether the result is decided, so that the rest of the elements
+// can be skipped.
+func (it *iterator) step(v interface{}) bool {
+	if it.f.form == mapForm {
+		it.res = append(it.res, v)
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		panic(&EvalError{Func: it.f.Name, Types: typesOf([]interface{}{v}),
+			Msg: fmt.Sprintf("invalid predicate: %T is not bool", v)})
+	}
+	switch it.f.form {
+	case allForm:
+		it.decided = !b
+	case anyForm, noneForm:
+		it.decided = b
+	case countForm:
+		if b {
+			it.count++
+		}
+	case filterForm:
+		if b {
+			it.res = append(it.res, it.elem)
+		}
+	}
+	return it.decided
+}
+
+// result returns the result of the call.
+func (it *iterator) result() interface{} {
+	switch it.f.form {
+	case allForm, noneForm:
+		return !it.decided
+	case anyForm:
+		return it.decided
+	case countForm:
+		return it.count
+	}
+	return it.res
+}
+
+// each evaluates n, a call in a lambda form, binding # to each element of
+// its array in turn.
+func (n FuncNode) each(env Resolver) interface{} {
+	it := newIterator(n.f, n.args[0].Eval(env))
+	s := scoped(env)
+	elem, bound := s.elem, s.bound
+	defer func() { s.elem, s.bound = elem, bound }()
+	s.bound = true
+	for it.next() {
+		s.elem = it.elem
+		if it.step(n.args[1].Eval(s)) {
+			break
+		}
+	}
+	v := it.result()
+	if s := limiter(env); s != nil {
+		s.checkSize(n, v)
+	}
+	return v
+}
+
+// strayElem returns the first # in node that isn't inside the predicate of
+// a call like any, or nil.
+func strayElem(node Node) Node {
+	var stray Node
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case ElemNode:
+			stray = n
+		case FuncNode:
+			if n.f != nil && n.f.form.lambda() && len(n.args) == 2 {
+				stray = strayElem(n.args[0])
+				return false
+			}
+		}
+		return stray == nil
+	})
+	return stray
+}
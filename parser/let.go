@@ -0,0 +1,123 @@
+package parser
+
+import "fmt"
+
+// local is a value bound by a let. It is evaluated on first use, with #
+// bound as it was at the let, and kept for the later ones.
+type local struct {
+	name  string
+	value Node
+	elem  interface{}
+	bound bool
+	val   interface{}
+	done  bool
+}
+
+// scoped returns the state of env, which binds # and the values of lets,
+// adding one if env has none. A nil env has no variables.
+func scoped(env Resolver) *state {
+	if s, ok := env.(*state); ok {
+		return s
+	}
+	if env == nil {
+		env = Env(nil)
+	}
+	return &state{Resolver: env}
+}
+
+func (n LetNode) Eval(env Resolver) interface{} {
+	if s := limiter(env); s != nil {
+		s.step(n)
+	}
+	s := scoped(env)
+	s.locals = append(s.locals, local{name: n.name, value: n.value, elem: s.elem, bound: s.bound})
+	defer func() { s.locals = s.locals[:len(s.locals)-1] }()
+	return n.body.Eval(s)
+}
+
+func (n LocalNode) Eval(env Resolver) interface{} {
+	if s, ok := env.(*state); ok {
+		for i := len(s.locals) - 1; i >= 0; i-- {
+			if s.locals[i].name == n.name {
+				return s.force(i)
+			}
+		}
+	}
+	panic(&EvalError{Node: n, Msg: fmt.Sprintf("%s is not bound by an enclosing let", n.name)})
+}
+
+// force returns the value of the i-th binding, evaluating it if it is the
+// first use.
+func (s *state) force(i int) interface{} {
+	l := s.locals[i]
+	if l.done {
+		return l.val
+	}
+	elem, bound := s.elem, s.bound
+	defer func() { s.elem, s.bound = elem, bound }()
+	s.elem, s.bound = l.elem, l.bound
+	v := l.value.Eval(s)
+	// evaluating the value may have grown s.locals into a new array
+	s.locals[i].val, s.locals[i].done = v, true
+	return v
+}
+
+// unbound returns the first node of the tree rooted at node that breaks the
+// scoping rules of let, and why: a name bound again while it is in scope,
+// or a reference to a binding from outside its body.
+func unbound(node Node) (Node, string) {
+	return checkScope(node, nil)
+}
+
+func checkScope(node Node, scope []string) (Node, string) {
+	switch n := node.(type) {
+	case LetNode:
+		if hasString(scope, n.name) {
+			return n, fmt.Sprintf("%s is already bound by an enclosing let", n.name)
+		}
+		if bad, msg := checkScope(n.value, scope); bad != nil {
+			if l, ok := bad.(LocalNode); ok && l.name == n.name {
+				msg = fmt.Sprintf("%s used before it is defined", n.name)
+			}
+			return bad, msg
+		}
+		return checkScope(n.body, append(scope[:len(scope):len(scope)], n.name))
+	case LocalNode:
+		if !hasString(scope, n.name) {
+			return n, fmt.Sprintf("%s is not bound by an enclosing let", n.name)
+		}
+	}
+	for _, child := range children(node) {
+		if bad, msg := checkScope(child, scope); bad != nil {
+			return bad, msg
+		}
+	}
+	return nil, ""
+}
+
+// substitute returns body with the references to the binding name, which
+// aren't shadowed by another let, replaced by the constant c.
+func substitute(body Node, name string, c Node) Node {
+	switch n := body.(type) {
+	case LocalNode:
+		if n.name == name {
+			return c
+		}
+		return n
+	case LetNode:
+		n.value = substitute(n.value, name, c)
+		if n.name != name {
+			n.body = substitute(n.body, name, c)
+		}
+		return n
+	}
+	kids := children(body)
+	if len(kids) == 0 {
+		return body
+	}
+	replaced := make([]Node, len(kids))
+	for i, kid := range kids {
+		replaced[i] = substitute(kid, name, c)
+	}
+	return withChildren(body, replaced)
+}
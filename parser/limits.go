@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Limits bounds the resources an evaluation may use. A zero field means
+// no limit.
+type Limits struct {
+	MaxSteps     int // operations performed, roughly one per node evaluated
+	MaxStringLen int // length in bytes of any string an operation produces
+	MaxArrayLen  int // length of any array or map an operation produces
+	MaxDepth     int // nesting depth of the expression
+}
+
+// LimitError reports an evaluation aborted for exceeding a limit. It is
+// wrapped in an *EvalError that points at the offending node.
+type LimitError struct {
+	Limit string // name of the Limits field, e.g. "MaxSteps"
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded %s of %d", e.Limit, e.Max)
+}
+
+// EvalContext is like EvalE, but aborts when ctx is done or when the
+// evaluation exceeds limits. The error then wraps ctx.Err() or a
+// *LimitError.
+func EvalContext(ctx context.Context, node Node, env interface{}, limits Limits, opts ...EvalOption) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := toEvalError(r)
+			if e.Node == nil {
+				e.Node = node
+			}
+			err = e
+		}
+	}()
+	s := newState(ctx, scope(env, opts), limits)
+	s.checkDepth(node)
+	return node.Eval(s), nil
+}
+
+// state is the Resolver of an evaluation that is strict or limited, or of
+// the predicate of a call like any or the body of a let. Nodes report their
+// work to it as they evaluate.
+type state struct {
+	Resolver
+	strict  bool
+	limited bool
+	done    <-chan struct{}
+	ctx     context.Context
+	limits  Limits
+	steps   int
+	elem    interface{} // the value of #, if bound
+	bound   bool
+	locals  []local // values bound by the enclosing lets, innermost last
+}
+
+func newState(ctx context.Context, env Resolver, limits Limits) *state {
+	s, ok := env.(*state)
+	if !ok {
+		s = &state{Resolver: env}
+	}
+	s.limited = true
+	s.ctx, s.done, s.limits = ctx, ctx.Done(), limits
+	if err := ctx.Err(); err != nil {
+		panic(&EvalError{Msg: err.Error(), Err: err})
+	}
+	return s
+}
+
+// pollEvery is how many steps pass between checks of the context.
+const pollEvery = 256
+
+// step counts one operation of n against the limits.
+func (s *state) step(n Node) {
+	s.steps++
+	if s.limits.MaxSteps > 0 && s.steps > s.limits.MaxSteps {
+		panic(limitError(n, "MaxSteps", s.limits.MaxSteps))
+	}
+	if s.steps%pollEvery == 0 && s.done != nil {
+		select {
+		case <-s.done:
+			err := s.ctx.Err()
+			panic(&EvalError{Node: n, Msg: err.Error(), Err: err})
+		default:
+		}
+	}
+}
+
+// checkSize checks v, produced by n, against the size limits.
+func (s *state) checkSize(n Node, v interface{}) {
+	switch x := v.(type) {
+	case string:
+		if s.limits.MaxStringLen > 0 && len(x) > s.limits.MaxStringLen {
+			panic(limitError(n, "MaxStringLen", s.limits.MaxStringLen))
+		}
+		return
+	case []interface{}:
+		s.checkLen(n, len(x))
+		return
+	case map[interface{}]interface{}:
+		s.checkLen(n, len(x))
+		return
+	case int64, float64, bool, nil:
+		return
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.String:
+		if s.limits.MaxStringLen > 0 && r.Len() > s.limits.MaxStringLen {
+			panic(limitError(n, "MaxStringLen", s.limits.MaxStringLen))
+		}
+	case reflect.Array, reflect.Slice, reflect.Map:
+		s.checkLen(n, r.Len())
+	}
+}
+
+func (s *state) checkLen(n Node, length int) {
+	if s.limits.MaxArrayLen > 0 && length > s.limits.MaxArrayLen {
+		panic(limitError(n, "MaxArrayLen", s.limits.MaxArrayLen))
+	}
+}
+
+// checkDepth checks the nesting depth of node.
+func (s *state) checkDepth(node Node) {
+	if s.limits.MaxDepth <= 0 {
+		return
+	}
+	if n := tooDeep(node, s.limits.MaxDepth); n != nil {
+		panic(limitError(n, "MaxDepth", s.limits.MaxDepth))
+	}
+}
+
+func limitError(n Node, limit string, max int) *EvalError {
+	err := &LimitError{limit, max}
+	return &EvalError{Node: n, Msg: err.Error(), Err: err}
+}
+
+// limiter returns the state of a limited evaluation in env, or nil. Nodes
+// test it before reporting to it, so that unlimited evaluations don't pay
+// for converting the node to an interface.
+func limiter(env Resolver) *state {
+	if s, ok := env.(*state); ok && s.limited {
+		return s
+	}
+	return nil
+}
+
+// tooDeep returns the first node nested more than max levels deep in
+// node, or nil.
+func tooDeep(node Node, max int) Node {
+	if max == 0 {
+		return node
+	}
+	for _, child := range children(node) {
+		if n := tooDeep(child, max-1); n != nil {
+			return n
+		}
+	}
+	return nil
+}
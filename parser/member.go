@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// member returns the field name of v, which must be a map with string keys,
+// a Resolver or a struct, or a pointer to one. A key missing from a map
+// yields nil, like indexing a map in Go; a missing struct field is an error.
+// Struct fields are named as in EnvOf.
+func member(v interface{}, name string) interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m[name]
+	case Resolver:
+		x, _ := m.Get(name)
+		return x
+	}
+
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		if r.IsNil() {
+			break
+		}
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Map:
+		return mapIndex(r, name)
+	case reflect.Struct:
+		if f, ok := field(r, name); ok {
+			return f
+		}
+		panic(&EvalError{Op: ".", Types: typesOf([]interface{}{v}),
+			Msg: fmt.Sprintf("%T has no field %s", v, name)})
+	}
+	panic(&EvalError{Op: ".", Types: typesOf([]interface{}{v}),
+		Msg: fmt.Sprintf("cannot access field %s of %T", name, v)})
+}
+
+// index returns v[i]. Arrays and slices take an integer index that must be
+// in range; maps take any key and yield nil when it is missing.
+func index(v, i interface{}) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		if k, ok := toInt(i); ok {
+			return x[checkIndex(k, len(x))]
+		}
+	case map[interface{}]interface{}:
+		if k, ok := mapKey(i); ok {
+			return x[k]
+		}
+		return nil
+	}
+
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		if r.IsNil() {
+			break
+		}
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Map:
+		return mapIndex(r, i)
+	case reflect.Array, reflect.Slice:
+		if k, ok := toInt(i); ok {
+			return r.Index(checkIndex(k, r.Len())).Interface()
+		}
+	}
+	panic(&EvalError{Op: "[]", Types: typesOf([]interface{}{v, i}),
+		Msg: fmt.Sprintf("invalid operation: cannot index %T with %T", v, i)})
+}
+
+func checkIndex(i int64, length int) int {
+	if i < 0 || i >= int64(length) {
+		panic(&EvalError{Op: "[]", Types: []string{"int64"},
+			Msg: fmt.Sprintf("index out of range [%d] with length %d", i, length)})
+	}
+	return int(i)
+}
+
+// mapIndex returns the value stored under key in the map m, or nil.
+func mapIndex(m reflect.Value, key interface{}) interface{} {
+	v, _ := lookup(m, key)
+	return v
+}
+
+func convertKey(k reflect.Value, to reflect.Type) (reflect.Value, bool) {
+	if !k.IsValid() {
+		return reflect.Value{}, false
+	}
+	switch {
+	case k.Type().AssignableTo(to):
+		return k, true
+	case k.Kind() == reflect.String && to.Kind() == reflect.String:
+		return k.Convert(to), true
+	case isInt(k.Kind()) && isInt(to.Kind()):
+		if i := k.Int(); !reflect.Zero(to).OverflowInt(i) {
+			return reflect.ValueOf(i).Convert(to), true
+		}
+	case isUint(k.Kind()) && isUint(to.Kind()):
+		if u := k.Uint(); !reflect.Zero(to).OverflowUint(u) {
+			return reflect.ValueOf(u).Convert(to), true
+		}
+	case isInt(k.Kind()) && isUint(to.Kind()):
+		if i := k.Int(); i >= 0 && !reflect.Zero(to).OverflowUint(uint64(i)) {
+			return reflect.ValueOf(i).Convert(to), true
+		}
+	case isUint(k.Kind()) && isInt(to.Kind()):
+		if u := k.Uint(); u <= math.MaxInt64 && !reflect.Zero(to).OverflowInt(int64(u)) {
+			return reflect.ValueOf(u).Convert(to), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+// toInt converts an integer of any type to int64.
+func toInt(v interface{}) (int64, bool) {
+	switch i := v.(type) {
+	case int:
+		return int64(i), true
+	case int8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case uint:
+		return int64(i), true
+	case uint8:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case uint64:
+		return int64(i), true
+	}
+	return 0, false
+}
@@ -1,14 +1,20 @@
 package parser
 
+// precedence returns the binding power of a binary operator, or 0 if op is
+// not one. The conditional operator ?: binds looser than all of them and is
+// handled by parseExpr; ** binds tighter than the unary operators and is
+// handled by parsePower.
 func precedence(op string) int {
 	switch op {
 	case "in", "not_in":
+		return 8
+	case "*", "/", "%", "<<", ">>", "&", "&^":
 		return 7
-	case "*", "/", "%":
+	case "+", "-", "|", "^":
 		return 6
-	case "+", "-":
+	case "??":
 		return 5
-	case "<", "<=", ">", ">=":
+	case "<", "<=", ">", ">=", "=~", "!~":
 		return 4
 	case "==", "!=":
 		return 3
@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Optimize returns node with its constant parts computed ahead of time.
+// Operators, conditionals and calls to pure functions whose operands are
+// all constants are folded into a single constant, an array of constants
+// on the right of in or not_in becomes a hashed set, and string literals
+// used as regular expressions are compiled. A let binding a constant gives
+// way to its body, with the constant in place of the name. Operations
+// that would fail, such as 1 / 0, are left for evaluation to report. Parse
+// optimizes the nodes it returns.
+func Optimize(node Node) Node {
+	switch n := node.(type) {
+	case UnaryNode:
+		n.x = Optimize(n.x)
+		return fold(n, n.x)
+	case BinaryNode:
+		n.x, n.y = Optimize(n.x), Optimize(n.y)
+		switch n.op {
+		case "??":
+			// a constant left operand decides which operand is the result
+			if _, ok := n.x.(NullNode); ok {
+				return n.y
+			}
+			if isConst(n.x) {
+				return n.x
+			}
+			return n
+		case "&&", "||":
+			// false && y and true || y are decided by their left operand
+			if b, ok := n.x.(BoolNode); ok && b.val == (n.op == "||") {
+				return BoolNode{b.val, n.span}
+			}
+		case "in", "not_in":
+			if array, ok := n.y.(ArrayNode); ok {
+				if s, ok := newSet(array.args); ok {
+					n.y = SetNode{array.args, s, array.span}
+				}
+			}
+		case "=~", "!~":
+			if c := fold(n, n.x, n.y); isConst(c) {
+				return c
+			}
+			n.y = compiled(n.y)
+			return n
+		}
+		return fold(n, n.x, n.y)
+	case CondNode:
+		n.cond, n.x, n.y = Optimize(n.cond), Optimize(n.x), Optimize(n.y)
+		if b, ok := n.cond.(BoolNode); ok {
+			if b.val {
+				return n.x
+			}
+			return n.y
+		}
+		return n
+	case LetNode:
+		n.value, n.body = Optimize(n.value), Optimize(n.body)
+		if isConst(n.value) {
+			// a constant is as cheap to repeat as to look up
+			return Optimize(substitute(n.body, n.name, n.value))
+		}
+		return n
+	case ArrayNode:
+		n.args = optimizeAll(n.args)
+		return n
+	case MapNode:
+		n.keys, n.vals = optimizeAll(n.keys), optimizeAll(n.vals)
+		return n
+	case FuncNode:
+		n.args = optimizeAll(n.args)
+		if n.f != nil && n.f.Pure && n.f.form == plain {
+			if c := fold(n, n.args...); isConst(c) {
+				return c
+			}
+		}
+		if n.f != nil {
+			for i, arg := range n.args {
+				if n.f.param(i).pattern {
+					n.args[i] = compiled(arg)
+				}
+			}
+		}
+		return n
+	case MemberNode:
+		n.x = Optimize(n.x)
+		return n
+	case IndexNode:
+		n.x, n.index = Optimize(n.x), Optimize(n.index)
+		return n
+	}
+	return node
+}
+
+func optimizeAll(nodes []Node) []Node {
+	res := make([]Node, len(nodes))
+	for i, n := range nodes {
+		res[i] = Optimize(n)
+	}
+	return res
+}
+
+// fold replaces n by a constant when all of its operands are constants.
+func fold(n Node, operands ...Node) Node {
+	for _, x := range operands {
+		if !isConst(x) {
+			return n
+		}
+	}
+	v, err := EvalE(n, nil)
+	if err != nil {
+		return n
+	}
+	if c, ok := literal(v, n.Span()); ok {
+		return c
+	}
+	return n
+}
+
+func isConst(n Node) bool {
+	switch n.(type) {
+	case IntNode, FloatNode, BoolNode, StringNode, NullNode:
+		return true
+	}
+	return false
+}
+
+// literal returns the literal node for v.
+func literal(v interface{}, span Span) (Node, bool) {
+	switch x := v.(type) {
+	case int64:
+		return IntNode{x, span}, true
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return nil, false // no literal for these
+		}
+		return FloatNode{x, span}, true
+	case bool:
+		return BoolNode{x, span}, true
+	case string:
+		return StringNode{x, span}, true
+	case nil:
+		return NullNode{span}, true
+	}
+	return nil, false
+}
+
+func (n SetNode) Eval(env Resolver) interface{} {
+	return n.set
+}
+
+// set is a set of constants. Numbers are hashed by value, so that an int
+// and a float that are equal, such as 2 and 2.0, are the same member, as
+// they are for ==.
+type set struct {
+	members map[interface{}]struct{}
+	elems   []interface{} // in source order, for printing
+}
+
+// newSet returns the set of elems, if they are all constants.
+func newSet(elems []Node) (*set, bool) {
+	s := &set{members: make(map[interface{}]struct{}, len(elems))}
+	for _, elem := range elems {
+		if !isConst(elem) {
+			return nil, false
+		}
+		v := elem.Eval(nil)
+		k, _ := hashKey(v)
+		s.members[k] = struct{}{}
+		s.elems = append(s.elems, v)
+	}
+	return s, true
+}
+
+// GoString formats s for disassembly, e.g. set{"tom", "jim"}.
+func (s *set) GoString() string {
+	var b strings.Builder
+	b.WriteString("set{")
+	for i, v := range s.elems {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%#v", v)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (s *set) has(v interface{}) bool {
+	k, ok := hashKey(v)
+	if !ok {
+		return false
+	}
+	_, ok = s.members[k]
+	return ok
+}
+
+// hashKey normalizes the bools, numbers and strings a set may hold. Whole
+// floats become int64, like the integers, and other floats float64.
+func hashKey(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case nil, bool, string, int64:
+		return x, true
+	case float64:
+		if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+			return int64(x), true
+		}
+		return x, true
+	case float32:
+		return hashKey(float64(x))
+	}
+	if i, ok := toInt(v); ok {
+		return i, true
+	}
+	return nil, false
+}
@@ -1,51 +1,85 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Cauchy-NY/eval/lexer"
 	"strconv"
 )
 
-func Parse(input string) (Node, error) {
+// Option configures Parse.
+type Option func(*Parser)
+
+// WithFunctions makes calls resolve against fs instead of the builtins.
+func WithFunctions(fs Functions) Option {
+	return func(p *Parser) { p.funcs = fs }
+}
+
+// Parse parses input into an expression tree. Malformed input is
+// reported as a *ParseError.
+func Parse(input string, opts ...Option) (_ Node, err error) {
 	tokens, err := lexer.Parse(input)
 	if err != nil {
-		return nil, err
+		if e, ok := err.(*lexer.Error); ok {
+			return nil, &ParseError{Input: input, Pos: e.Pos, Msg: e.Msg}
+		}
+		return nil, &ParseError{Input: input, Msg: err.Error()}
 	}
 
-	if len(tokens) == 0 {
-		return nil, errors.New(fmt.Sprintf("input [%s] has none valid ast", input))
-	}
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case parserPanic:
+			x.Input = input
+			err = x.ParseError
+		default:
+			// unexpected panic: resume state of panic.
+			panic(x)
+		}
+	}()
 
 	p := NewParser(tokens)
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	node := p.parseExpr()
 
 	if !p.cur.Is(lexer.EOF) {
-		return nil, errors.New(fmt.Sprintf("unexpected ast [%v]", p.cur))
+		p.error([]string{"operator", "end of file"}, "unexpected %s", p.describe())
 	}
-
-	if p.err != nil {
-		return nil, p.err
+	if n := strayElem(node); n != nil {
+		p.errorAt(p.tokenAt(n.Span().Start), nil, "# used outside of a predicate")
 	}
 
-	return node, nil
+	return Optimize(node), nil
 }
 
 func NewParser(tokens []lexer.Token) *Parser {
 	return &Parser{
 		tokens: tokens,
 		cur:    tokens[0],
+		funcs:  builtins,
 	}
 }
 
-type parserPanic string
+type parserPanic struct {
+	*ParseError
+}
 
 type Parser struct {
 	tokens []lexer.Token
 	cur    lexer.Token
 	pos    int
-	err    error
+	funcs  Functions // functions calls resolve against
+	scope  []binding // names bound by the enclosing lets, innermost last
+}
+
+// binding is a name bound by a let, which is defined once its value has
+// been parsed.
+type binding struct {
+	name    string
+	defined bool
 }
 
 func (p *Parser) describe() string {
@@ -56,6 +90,10 @@ func (p *Parser) describe() string {
 		return fmt.Sprintf("number %s", p.cur.Value())
 	case lexer.Bool:
 		return fmt.Sprintf("bool %s", p.cur.Value())
+	case lexer.Null:
+		return "null"
+	case lexer.Keyword:
+		return fmt.Sprintf("keyword %s", p.cur.Value())
 	case lexer.Char, lexer.String:
 		return fmt.Sprintf("string %s", p.cur.Value())
 	case lexer.Operator:
@@ -68,138 +106,407 @@ func (p *Parser) describe() string {
 	return fmt.Sprintf("%v", p.cur.Value()) // any other rune
 }
 
-func (p *Parser) error(format string, args ...interface{}) {
-	if p.err == nil { // show first error
-		p.err = errors.New(fmt.Sprintf(format, args))
-	}
+// error aborts parsing at the current token. expected lists the tokens
+// that would have been accepted in its place.
+func (p *Parser) error(expected []string, format string, args ...interface{}) {
+	p.errorAt(p.cur, expected, format, args...)
+}
+
+// errorAt is like error, but blames tok instead of the current token.
+func (p *Parser) errorAt(tok lexer.Token, expected []string, format string, args ...interface{}) {
+	panic(parserPanic{&ParseError{
+		Pos:      tok.Pos(),
+		Token:    tok,
+		Expected: expected,
+		Msg:      fmt.Sprintf(format, args...),
+	}})
 }
 
 func (p *Parser) next() {
-	p.pos++
-	if p.pos >= len(p.tokens) {
-		p.error("unexpected end of expression")
-		return
+	if p.pos+1 >= len(p.tokens) {
+		p.error(nil, "unexpected end of expression")
 	}
+	p.pos++
 	p.cur = p.tokens[p.pos]
 }
 
-func (p *Parser) expect(tp lexer.Type, values ...string) {
-	if p.cur.Is(tp, values...) {
-		p.next()
-		return
+// expect consumes the current token, which must be a bracket or operator
+// with value val.
+func (p *Parser) expect(val string, alternatives ...string) {
+	if p.cur.Value() != val || !p.cur.Is(lexer.Bracket) && !p.cur.Is(lexer.Operator) {
+		expected := append([]string{strconv.Quote(val)}, alternatives...)
+		p.error(expected, "unexpected %s", p.describe())
 	}
-	p.error("unexpected ast %v", p.cur)
+	p.next()
 }
 
+// spanFrom returns the span from start to the end of the last consumed token.
+func (p *Parser) spanFrom(start lexer.Position) Span {
+	return Span{start, p.tokens[p.pos-1].End()}
+}
+
+// operand lists the tokens that may start an operand.
+var operand = []string{"identifier", "number", "bool", "string", "null", `"("`, `"["`, `"{"`, `"+"`, `"-"`, `"!"`, `"^"`}
+
+// parseExpr parses a let or a conditional expression, cond ? x : y, which
+// bind looser than any binary operator and associate to the right.
 func (p *Parser) parseExpr() Node {
-	return p.parseBinary(1)
+	if p.cur.Is(lexer.Keyword, "let") {
+		return p.parseLet()
+	}
+	start := p.cur.Pos()
+	cond := p.parseBinary(1)
+	if !p.cur.Is(lexer.Operator, "?") {
+		return cond
+	}
+	p.next() // consume '?'
+	x := p.parseExpr()
+	p.expect(":", "operator")
+	y := p.parseExpr()
+	return CondNode{cond, x, y, p.spanFrom(start)}
+}
+
+// parseLet parses let name = value; body. The name is in scope in body,
+// where it shadows the variable of the same name, but not in value. It
+// can't be bound again while it is in scope.
+func (p *Parser) parseLet() Node {
+	start := p.cur.Pos()
+	p.next() // consume let
+	if !p.cur.Is(lexer.Ident) {
+		p.error([]string{"identifier"}, "unexpected %s", p.describe())
+	}
+	name := p.cur.Value()
+	if p.lookup(name) != nil {
+		p.error(nil, "%s is already bound by an enclosing let", name)
+	}
+	p.next() // consume Ident
+	p.expect("=")
+	p.scope = append(p.scope, binding{name: name})
+	value := p.parseExpr()
+	p.expect(";", "operator")
+	p.scope[len(p.scope)-1].defined = true
+	body := p.parseExpr()
+	p.scope = p.scope[:len(p.scope)-1]
+	return LetNode{name, value, body, p.spanFrom(start)}
+}
+
+// lookup returns the binding of name by an enclosing let, or nil.
+func (p *Parser) lookup(name string) *binding {
+	for i := len(p.scope) - 1; i >= 0; i-- {
+		if p.scope[i].name == name {
+			return &p.scope[i]
+		}
+	}
+	return nil
 }
 
 func (p *Parser) parseBinary(basePrec int) Node {
+	start := p.cur.Pos()
 	left := p.parseUnary()
-	for prec := precedence(p.cur.Value()); prec >= basePrec; prec-- {
-		for precedence(p.cur.Value()) == prec {
+	for prec := p.binaryPrec(); prec >= basePrec; prec-- {
+		for p.binaryPrec() == prec {
 			op := p.cur.Value()
 			p.next() // consume operator
 			right := p.parseBinary(prec + 1)
-			left = BinaryNode{op, left, right}
+			if op == "=~" || op == "!~" {
+				if err := checkPattern(right); err != nil {
+					p.errorAt(p.tokenAt(right.Span().Start), nil, "%v", err)
+				}
+			}
+			left = BinaryNode{op, left, right, p.spanFrom(start)}
 		}
 	}
 	return left
 }
 
+// binaryPrec returns the precedence of the current token if it is a binary
+// operator, or 0. A string such as "+" is not an operator.
+func (p *Parser) binaryPrec() int {
+	if !p.cur.Is(lexer.Operator) {
+		return 0
+	}
+	return precedence(p.cur.Value())
+}
+
 func (p *Parser) parseUnary() Node {
-	if p.cur.Is(lexer.Operator, "+", "-", "!") {
+	if p.cur.Is(lexer.Operator, "+", "-", "!", "^") {
+		start := p.cur.Pos()
 		op := string(p.cur.Value())
-		p.next() // consume "+", "-" or "!"
-		return UnaryNode{op, p.parseUnary()}
+		p.next() // consume "+", "-", "!" or "^"
+		x := p.parseUnary()
+		return UnaryNode{op, x, p.spanFrom(start)}
+	}
+	return p.parsePower()
+}
+
+// parsePower parses a postfix expression raised to a power, if followed by
+// **. Like in math, ** binds tighter than a unary operator on its left and
+// associates to the right: -2 ** 2 is -(2 ** 2) and 2 ** 3 ** 2 is
+// 2 ** (3 ** 2). The exponent may have a unary operator, as in 2 ** -1.
+func (p *Parser) parsePower() Node {
+	start := p.cur.Pos()
+	x := p.parsePostfix()
+	if !p.cur.Is(lexer.Operator, "**") {
+		return x
+	}
+	p.next() // consume "**"
+	y := p.parseUnary()
+	return BinaryNode{"**", x, y, p.spanFrom(start)}
+}
+
+// parsePostfix parses a primary followed by any number of member
+// accesses and indexes, e.g. user.tags[0].name or user?.tags?.[0]. Once a
+// link of the chain is optional, so are the ones after it: a nil anywhere
+// from there on ends the chain with nil.
+func (p *Parser) parsePostfix() Node {
+	start := p.cur.Pos()
+	x := p.parsePrimary()
+	optional := false
+	for {
+		if p.optionalChain() {
+			p.next() // consume '?'
+			p.next() // consume '.'
+			optional = true
+			if !p.cur.Is(lexer.Bracket, "[") {
+				x = p.parseMember(x, optional, start)
+				continue
+			}
+		}
+		switch {
+		case p.cur.Is(lexer.Operator, "."):
+			p.next() // consume '.'
+			x = p.parseMember(x, optional, start)
+		case p.cur.Is(lexer.Bracket, "["):
+			p.next() // consume '['
+			index := p.parseExpr()
+			p.expect("]", "operator")
+			x = IndexNode{x, index, optional, p.spanFrom(start)}
+		default:
+			return x
+		}
+	}
+}
+
+// optionalChain reports whether the current tokens are ?. : a '?'
+// immediately followed by a '.'. The lexer keeps them apart, since in
+// a ?.5 : b they are a conditional and a number.
+func (p *Parser) optionalChain() bool {
+	if !p.cur.Is(lexer.Operator, "?") || p.pos+1 >= len(p.tokens) {
+		return false
+	}
+	next := p.tokens[p.pos+1]
+	return next.Is(lexer.Operator, ".") && next.Pos() == p.cur.End()
+}
+
+// parseMember parses the name of a member access of x, after the '.'.
+func (p *Parser) parseMember(x Node, optional bool, start lexer.Position) Node {
+	if !p.cur.Is(lexer.Ident) {
+		p.error([]string{"identifier"}, "unexpected %s", p.describe())
+	}
+	name := p.cur.Value()
+	p.next() // consume Ident
+	return MemberNode{x, name, optional, p.spanFrom(start)}
+}
+
+// parseList parses a comma separated list of expressions up to and
+// including the closing bracket.
+func (p *Parser) parseList(closing string) []Node {
+	var args []Node
+	if !p.cur.Is(lexer.Bracket, closing) {
+		for {
+			args = append(args, p.parseExpr())
+			if !p.cur.Is(lexer.Operator, ",") {
+				break
+			}
+			p.next() // consume ','
+		}
+	}
+	p.expect(closing, `","`, "operator")
+	return args
+}
+
+// parseMap parses the entries of a map literal up to and including the
+// closing '}'. Constant keys may not be repeated.
+func (p *Parser) parseMap(start lexer.Position) Node {
+	var keys, vals []Node
+	seen := make(map[interface{}]bool)
+	if !p.cur.Is(lexer.Bracket, "}") {
+		for {
+			tok := p.cur
+			key := p.parseExpr()
+			if k, ok := constKey(key); ok {
+				if seen[k] {
+					p.errorAt(tok, nil, "duplicate key %v in map literal", k)
+				}
+				seen[k] = true
+			}
+			p.expect(":", "operator")
+			keys = append(keys, key)
+			vals = append(vals, p.parseExpr())
+			if !p.cur.Is(lexer.Operator, ",") {
+				break
+			}
+			p.next() // consume ','
+		}
 	}
-	return p.parsePrimary()
+	p.expect("}", `","`, "operator")
+	return MapNode{keys, vals, p.spanFrom(start)}
+}
+
+// resolve looks up the function called by tok and checks the number and
+// the types of args against its parameters.
+func (p *Parser) resolve(tok lexer.Token, args []Node) *Function {
+	f, err := resolveCall(p.funcs, tok.Value(), args)
+	if err != nil {
+		if err.arg < 0 {
+			p.errorAt(tok, err.expected, "%s", err.msg)
+		}
+		p.errorAt(p.tokenAt(args[err.arg].Span().Start), err.expected, "%s", err.msg)
+	}
+	return f
+}
+
+// callError is a call that doesn't match the function it calls. arg is
+// the index of the offending argument, or -1 for the call as a whole.
+type callError struct {
+	arg      int
+	expected []string
+	msg      string
+}
+
+// resolveCall looks up the function name in funcs and checks the number
+// and the types of args against its parameters.
+func resolveCall(funcs Functions, name string, args []Node) (*Function, *callError) {
+	f, ok := funcs[name]
+	if !ok {
+		return nil, &callError{-1, nil, fmt.Sprintf("unknown function %s", name)}
+	}
+	min, max := f.arity()
+	if len(args) < min {
+		return nil, &callError{-1, nil, fmt.Sprintf("not enough arguments in call to %s", name)}
+	}
+	if max >= 0 && len(args) > max {
+		return nil, &callError{-1, nil, fmt.Sprintf("too many arguments in call to %s", name)}
+	}
+	if f.form.probes() && len(args) > 0 && !isPath(args[0]) {
+		return nil, &callError{0, []string{"variable"},
+			fmt.Sprintf("invalid argument 1 to %s: not a variable or a field of one", name)}
+	}
+	c := &checker{loose: true}
+	types := make([]*Type, len(args))
+	for i, arg := range args {
+		// variables are of unknown type until run time
+		if i == 1 && f.form.lambda() {
+			types[i] = c.predicate(arg, types[0])
+		} else {
+			types[i] = c.check(arg)
+		}
+		if t, param := types[i], f.param(i); !param.admits(t) {
+			expected := []string(nil)
+			if param.check == nil && param.Type != nil {
+				expected = []string{param.Type.String()}
+			}
+			return nil, &callError{i, expected, fmt.Sprintf("invalid argument %d to %s: %s", i+1, name, t)}
+		}
+		if f.param(i).pattern {
+			if err := checkPattern(arg); err != nil {
+				return nil, &callError{i, nil, fmt.Sprintf("invalid argument %d to %s: %v", i+1, name, err)}
+			}
+		}
+	}
+	return f, nil
+}
+
+// tokenAt returns the token starting at pos.
+func (p *Parser) tokenAt(pos lexer.Position) lexer.Token {
+	for _, tok := range p.tokens {
+		if tok.Pos().Offset == pos.Offset {
+			return tok
+		}
+	}
+	return p.cur
+}
+
+// constKey returns the map key a literal node stands for.
+func constKey(n Node) (interface{}, bool) {
+	switch n := n.(type) {
+	case IntNode:
+		return mapKey(n.val)
+	case FloatNode:
+		return mapKey(n.val)
+	case StringNode:
+		return n.val, true
+	}
+	return nil, false
 }
 
 func (p *Parser) parsePrimary() Node {
+	start := p.cur.Pos()
 	switch p.cur.Type() {
 	case lexer.Ident:
+		tok := p.cur
 		ident := p.cur.Value()
-		p.next()                  // consume Ident
-		if p.cur.Value() == "(" { //deal with buildin func
+		p.next()                          // consume Ident
+		if p.cur.Is(lexer.Bracket, "(") { //deal with buildin func
 			p.next() // consume '('
-			var args []Node
-			if p.cur.Value() != ")" {
-				for {
-					args = append(args, p.parseExpr())
-					if p.cur.Value() != "," {
-						break
-					}
-					p.next() // consume ','
-				}
-				if p.cur.Value() != ")" {
-					msg := fmt.Sprintf("got %v, want ')'", p.cur.Value())
-					panic(parserPanic(msg))
-				}
+			args := p.parseList(")")
+			return FuncNode{ident, args, p.resolve(tok, args), p.spanFrom(start)}
+		} else if b := p.lookup(ident); b != nil {
+			if !b.defined {
+				p.errorAt(tok, nil, "%s used before it is defined", ident)
 			}
-			p.next() // consume ')'
-			return FuncNode{ident, args}
+			return LocalNode{ident, p.spanFrom(start)}
 		} else {
-			return IdentNode{ident}
+			return IdentNode{ident, p.spanFrom(start)}
 		}
 	case lexer.Int:
 		i, err := strconv.ParseInt(p.cur.Value(), 10, 64)
 		if err != nil {
-			panic(parserPanic(err.Error()))
+			p.error(nil, "invalid number %s: %v", p.cur.Value(), err.(*strconv.NumError).Err)
 		}
 		p.next() // consume int
-		return IntNode{i}
+		return IntNode{i, p.spanFrom(start)}
 	case lexer.Float:
 		f, err := strconv.ParseFloat(p.cur.Value(), 64)
 		if err != nil {
-			panic(parserPanic(err.Error()))
+			p.error(nil, "invalid number %s: %v", p.cur.Value(), err.(*strconv.NumError).Err)
 		}
 		p.next() // consume float
-		return FloatNode{f}
+		return FloatNode{f, p.spanFrom(start)}
 	case lexer.Bool:
 		b, err := strconv.ParseBool(p.cur.Value())
 		if err != nil {
-			panic(parserPanic(err.Error()))
+			p.error(nil, "invalid bool %s", p.cur.Value())
 		}
 		p.next() // consume bool
-		return BoolNode{b}
+		return BoolNode{b, p.spanFrom(start)}
 	case lexer.Char, lexer.String:
 		str := p.cur.Value()
 		p.next() // consume string or char
-		return StringNode{str}
+		return StringNode{str, p.spanFrom(start)}
+	case lexer.Null:
+		p.next() // consume null
+		return NullNode{p.spanFrom(start)}
+	case lexer.Operator:
+		if p.cur.Value() == "#" {
+			p.next() // consume '#'
+			return ElemNode{p.spanFrom(start)}
+		}
 	case lexer.Bracket:
 		if p.cur.Value() == "(" {
 			p.next() // consume '('
 			node := p.parseExpr()
-			if p.cur.Value() != ")" {
-				msg := fmt.Sprintf("got %v, want ')'", p.describe())
-				panic(parserPanic(msg))
-			}
-			p.next() // consume ')'
+			p.expect(")", "operator")
 			return node
 		} else if p.cur.Value() == "[" { // deal with array node
 			p.next() // consume '['
-			var args []Node
-			if p.cur.Value() != "]" {
-				for {
-					args = append(args, p.parseExpr())
-					if p.cur.Value() != "," {
-						break
-					}
-					p.next() // consume ','
-				}
-				if p.cur.Value() != "]" {
-					msg := fmt.Sprintf("got %v, want ']'", p.cur.Value())
-					panic(parserPanic(msg))
-				}
-			}
-			p.next() // consume ']'
-			return ArrayNode{args}
-		} else {
-			// map is not support for now
+			args := p.parseList("]")
+			return ArrayNode{args, p.spanFrom(start)}
+		} else if p.cur.Value() == "{" { // deal with map node
+			p.next() // consume '{'
+			return p.parseMap(start)
 		}
 	}
-	msg := fmt.Sprintf("unexpected %s", p.describe())
-	panic(parserPanic(msg))
+	p.error(operand, "unexpected %s", p.describe())
+	panic("unreachable")
 }
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"regexp"
+	"sync"
+)
+
+// RegexNode is a string literal used as a regular expression: the right
+// operand of =~ or !~, or the pattern of a regex builtin. Optimize
+// compiles such literals once, so evaluations don't have to.
+type RegexNode struct {
+	re   *regexp.Regexp
+	span Span
+}
+
+func (n RegexNode) Eval(env Resolver) interface{} {
+	return n.re
+}
+
+func (n RegexNode) Span() Span     { return n.span }
+func (n RegexNode) String() string { return Format(n) }
+
+// Pattern returns the source of the regular expression.
+func (n RegexNode) Pattern() string { return n.re.String() }
+
+// checkPattern reports whether n, if it is a string literal, is a valid
+// regular expression. Patterns only known at run time are checked then.
+func checkPattern(n Node) error {
+	if s, ok := n.(StringNode); ok {
+		_, err := regexp.Compile(s.val)
+		return err
+	}
+	return nil
+}
+
+// compiled returns n compiled into a RegexNode if it is a valid pattern
+// literal, and n otherwise.
+func compiled(n Node) Node {
+	if s, ok := n.(StringNode); ok {
+		if re, err := regexp.Compile(s.val); err == nil {
+			return RegexNode{re, s.span}
+		}
+	}
+	return n
+}
+
+// patterns caches the regular expressions compiled at run time, for
+// patterns that aren't literals. It stops growing at maxPatterns entries,
+// so that expressions building patterns from their input can't exhaust
+// memory.
+var patterns = struct {
+	sync.RWMutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+const maxPatterns = 1024
+
+// pattern returns the regular expression v, which is either already
+// compiled or a string to compile. It returns nil and no error if v is
+// neither.
+func pattern(v interface{}) (*regexp.Regexp, error) {
+	switch x := v.(type) {
+	case *regexp.Regexp:
+		return x, nil
+	case string:
+		patterns.RLock()
+		re, ok := patterns.m[x]
+		patterns.RUnlock()
+		if ok {
+			return re, nil
+		}
+		re, err := regexp.Compile(x)
+		if err != nil {
+			return nil, err
+		}
+		patterns.Lock()
+		if len(patterns.m) < maxPatterns {
+			patterns.m[x] = re
+		}
+		patterns.Unlock()
+		return re, nil
+	}
+	return nil, nil
+}
+
+// match reports whether the string s matches the pattern p, for the
+// operator op, =~ or !~.
+func match(op string, s, p interface{}) bool {
+	x, ok := s.(string)
+	re, err := pattern(p)
+	switch {
+	case err != nil:
+		panic(&EvalError{Op: op, Msg: err.Error(), Err: err})
+	case !ok || re == nil:
+		panic(opError(op, s, p))
+	}
+	return re.MatchString(x)
+}
@@ -0,0 +1,398 @@
+package parser
+
+import "context"
+
+// small is the stack and variable count up to which a run keeps its
+// scratch space on the Go stack.
+const small = 8
+
+// unloaded marks a variable slot that hasn't been looked up yet, and
+// missing one that was looked up but isn't in the environment.
+var (
+	unloaded = new(struct{})
+	missing  = new(struct{})
+)
+
+// Run executes the program in env, which is anything EnvOf accepts. Like
+// EvalE, it reports runtime failures as an *EvalError instead of panicking.
+func (p *Program) Run(env interface{}, opts ...EvalOption) (interface{}, error) {
+	return p.run(context.Background(), nil, env, opts)
+}
+
+// RunContext is like Run, but aborts when ctx is done or when the run
+// exceeds limits, like EvalContext. Steps count instructions executed.
+func (p *Program) RunContext(ctx context.Context, env interface{}, limits Limits, opts ...EvalOption) (interface{}, error) {
+	return p.run(ctx, &limits, env, opts)
+}
+
+func (p *Program) run(ctx context.Context, limits *Limits, v interface{}, opts []EvalOption) (_ interface{}, err error) {
+	if limits == nil && len(p.code) == 1 && p.code[0].op == opConst {
+		// Parse folds constant expressions, so many programs are a single
+		// constant that needs neither the machine nor, for an Env, a scope.
+		if _, ok := v.(Env); ok {
+			return p.consts[p.code[0].arg], nil
+		}
+	}
+	var stackBuf, slotBuf [small]interface{}
+	stack, slots := stackBuf[:], slotBuf[:]
+	if p.maxStack > small {
+		stack = make([]interface{}, p.maxStack)
+	}
+	if len(p.names) > small {
+		slots = make([]interface{}, len(p.names))
+	}
+	slots = slots[:len(p.names)]
+	for i := range slots {
+		slots[i] = unloaded
+	}
+
+	// pc is kept one past the instruction being executed, so that a
+	// failure can be blamed on it.
+	sp, pc := 0, 0
+	defer func() {
+		if r := recover(); r != nil {
+			e := toEvalError(r)
+			if e.Node == nil && pc > 0 {
+				e.Node = p.nodes[pc-1]
+			}
+			err = e
+		}
+	}()
+	env := scope(v, opts)
+	if limits != nil {
+		s := newState(ctx, env, *limits)
+		s.checkDepth(p.root)
+		env = s
+	}
+	var frames []frame // uses of let values being evaluated, innermost last
+	st, limited := env.(*state)
+	limited = limited && st.limited
+	for pc < len(p.code) {
+		ins := p.code[pc]
+		pc++
+		if limited {
+			st.step(p.nodes[pc-1])
+		}
+		switch ins.op {
+		case opConst:
+			stack[sp] = p.consts[ins.arg]
+			sp++
+		case opLoad:
+			v := p.load(env, slots, ins.arg)
+			if v == missing {
+				if isStrict(env) {
+					panic(undefined(p.nodes[pc-1].(IdentNode)))
+				}
+				v = nil
+			}
+			stack[sp] = v
+			sp++
+		case opPos:
+			stack[sp-1] = add(0, stack[sp-1])
+		case opNeg:
+			stack[sp-1] = sub(0, stack[sp-1])
+		case opNot:
+			stack[sp-1] = not(stack[sp-1])
+		case opBitNot:
+			stack[sp-1] = bitNot(stack[sp-1])
+		case opAdd:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x + y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x + y
+			} else {
+				stack[sp-1] = add(stack[sp-1], stack[sp])
+				if limited {
+					st.checkSize(p.nodes[pc-1], stack[sp-1])
+				}
+			}
+		case opSub:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x - y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x - y
+			} else {
+				stack[sp-1] = sub(stack[sp-1], stack[sp])
+			}
+		case opMul:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x * y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x * y
+			} else {
+				stack[sp-1] = mul(stack[sp-1], stack[sp])
+			}
+		case opDiv:
+			sp--
+			stack[sp-1] = div(stack[sp-1], stack[sp])
+		case opMod:
+			sp--
+			stack[sp-1] = mod(stack[sp-1], stack[sp])
+		case opPow:
+			sp--
+			stack[sp-1] = power(stack[sp-1], stack[sp])
+		case opBitAnd:
+			sp--
+			if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x & y
+			} else {
+				stack[sp-1] = bitAnd(stack[sp-1], stack[sp])
+			}
+		case opBitOr:
+			sp--
+			if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x | y
+			} else {
+				stack[sp-1] = bitOr(stack[sp-1], stack[sp])
+			}
+		case opBitXor:
+			sp--
+			stack[sp-1] = bitXor(stack[sp-1], stack[sp])
+		case opBitClear:
+			sp--
+			stack[sp-1] = bitClear(stack[sp-1], stack[sp])
+		case opShl:
+			sp--
+			stack[sp-1] = shl(stack[sp-1], stack[sp])
+		case opShr:
+			sp--
+			stack[sp-1] = shr(stack[sp-1], stack[sp])
+		case opGt:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x > y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x > y
+			} else {
+				stack[sp-1] = gt(stack[sp-1], stack[sp])
+			}
+		case opLt:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x < y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x < y
+			} else {
+				stack[sp-1] = lt(stack[sp-1], stack[sp])
+			}
+		case opGe:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x >= y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x >= y
+			} else {
+				stack[sp-1] = ge(stack[sp-1], stack[sp])
+			}
+		case opLe:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x <= y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x <= y
+			} else {
+				stack[sp-1] = le(stack[sp-1], stack[sp])
+			}
+		case opEq:
+			sp--
+			if x, y, ok := floats(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x == y
+			} else if x, y, ok := ints(stack[sp-1], stack[sp]); ok {
+				stack[sp-1] = x == y
+			} else {
+				stack[sp-1] = eq(stack[sp-1], stack[sp])
+			}
+		case opNe:
+			sp--
+			stack[sp-1] = ne(stack[sp-1], stack[sp])
+		case opAnd:
+			sp--
+			stack[sp-1] = and(stack[sp-1], stack[sp])
+		case opOr:
+			sp--
+			stack[sp-1] = or(stack[sp-1], stack[sp])
+		case opIn:
+			sp--
+			stack[sp-1] = in(stack[sp-1], stack[sp])
+		case opNotIn:
+			sp--
+			stack[sp-1] = !in(stack[sp-1], stack[sp])
+		case opMatch:
+			sp--
+			stack[sp-1] = match("=~", stack[sp-1], stack[sp])
+		case opNotMatch:
+			sp--
+			stack[sp-1] = !match("!~", stack[sp-1], stack[sp])
+		case opJumpIfFalse:
+			if b, ok := stack[sp-1].(bool); ok && !b {
+				pc = int(ins.arg)
+			}
+		case opJumpIfTrue:
+			if b, ok := stack[sp-1].(bool); ok && b {
+				pc = int(ins.arg)
+			}
+		case opBranch:
+			sp--
+			if !truth(stack[sp]) {
+				pc = int(ins.arg)
+			}
+		case opJump:
+			pc = int(ins.arg)
+		case opArray:
+			n := int(ins.arg)
+			list := make([]interface{}, n)
+			copy(list, stack[sp-n:sp])
+			sp -= n - 1
+			stack[sp-1] = list
+			if limited {
+				st.checkLen(p.nodes[pc-1], n)
+			}
+		case opMap:
+			n := int(ins.arg)
+			m := make(map[interface{}]interface{}, n)
+			for i := sp - 2*n; i < sp; i += 2 {
+				setKey(m, stack[i], stack[i+1])
+			}
+			sp -= 2*n - 1
+			stack[sp-1] = m
+			if limited {
+				st.checkLen(p.nodes[pc-1], len(m))
+			}
+		case opMember:
+			stack[sp-1] = member(stack[sp-1], p.consts[ins.arg].(string))
+		case opIndex:
+			sp--
+			stack[sp-1] = index(stack[sp-1], stack[sp])
+		case opCall:
+			c := p.calls[ins.arg]
+			args := make([]interface{}, c.argc)
+			copy(args, stack[sp-c.argc:sp])
+			sp -= c.argc - 1
+			stack[sp-1] = c.fn.call(args)
+			if limited {
+				st.checkSize(p.nodes[pc-1], stack[sp-1])
+			}
+		case opProbeLoad:
+			v := p.load(env, slots, ins.arg)
+			if v == missing {
+				v = nil
+			}
+			stack[sp] = v
+			sp++
+		case opProbeMember:
+			if x := stack[sp-1]; !isNil(x) {
+				stack[sp-1] = try(func() interface{} { return member(x, p.consts[ins.arg].(string)) })
+			}
+		case opProbeIndex:
+			sp--
+			if x, i := stack[sp-1], stack[sp]; !isNil(x) {
+				stack[sp-1] = try(func() interface{} { return index(x, i) })
+			}
+		case opNotNil:
+			stack[sp-1] = !isNil(stack[sp-1])
+		case opJumpIfNotNil:
+			if !isNil(stack[sp-1]) {
+				pc = int(ins.arg)
+			}
+		case opJumpIfNil:
+			if isNil(stack[sp-1]) {
+				stack[sp-1] = nil // a nil pointer, slice or map yields plain nil
+				pc = int(ins.arg)
+			}
+		case opPop:
+			sp--
+		case opIter:
+			stack[sp-1] = newIterator(p.calls[ins.arg].fn, stack[sp-1])
+		case opNext:
+			if !stack[sp-1].(*iterator).next() {
+				pc = int(ins.arg)
+			}
+		case opElem:
+			stack[sp] = stack[ins.arg].(*iterator).elem
+			sp++
+		case opStep:
+			sp--
+			if !stack[sp-1].(*iterator).step(stack[sp]) {
+				pc = int(ins.arg)
+			}
+		case opDone:
+			stack[sp-1] = stack[sp-1].(*iterator).result()
+			if limited {
+				st.checkSize(p.nodes[pc-1], stack[sp-1])
+			}
+		case opLet:
+			stack[sp] = thunk(pc + 1)
+			for i := sp + 1; i < sp+int(ins.arg); i++ {
+				stack[i] = nil
+			}
+			sp += int(ins.arg)
+		case opBind:
+			v := stack[sp-1]
+			f := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			sp, pc = f.sp, f.pc
+			stack[sp] = v
+			sp++
+		case opLocal:
+			if t, ok := stack[ins.arg].(thunk); ok {
+				// evaluate the value in its slots; opBind comes back here
+				frames = append(frames, frame{pc, sp})
+				sp, pc = int(ins.arg), int(t)
+				break
+			}
+			stack[sp] = stack[ins.arg]
+			sp++
+		case opUnbind:
+			v := stack[sp-1]
+			sp -= int(ins.arg)
+			stack[sp-1] = v
+		}
+	}
+	return stack[0], nil
+}
+
+// thunk is the value of a let not used yet: the address of its code.
+type thunk int
+
+// frame is where to resume, and at which stack depth, once the value of a
+// let has been evaluated.
+type frame struct {
+	pc, sp int
+}
+
+// load returns the variable in slot i, looking it up on first use.
+func (p *Program) load(env Resolver, slots []interface{}, i int32) interface{} {
+	v := slots[i]
+	if v == unloaded {
+		var ok bool
+		if v, ok = env.Get(p.names[i]); !ok {
+			v = missing
+		}
+		slots[i] = v
+	}
+	return v
+}
+
+// floats and ints are fast paths for operands that are both float64 or both
+// int64, the types of number literals. Others go through the helpers.
+
+func floats(a, b interface{}) (float64, float64, bool) {
+	x, ok := a.(float64)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := b.(float64)
+	return x, y, ok
+}
+
+func ints(a, b interface{}) (int64, int64, bool) {
+	x, ok := a.(int64)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := b.(int64)
+	return x, y, ok
+}
@@ -0,0 +1,129 @@
+package parser
+
+// A Visitor's Visit method is called by Walk for each node it meets. If the
+// result w is not nil, Walk visits each of the children of node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order: it calls
+// v.Visit(node), then walks the children of node with the visitor it
+// returns, in source order. Map entries are visited as key, then value.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order, calling
+// f(node) for each node and then f(nil) after its children. The children
+// of a node are skipped when f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite returns a copy of the tree rooted at node in which each node is
+// replaced by what f returns for it. It works bottom-up: f is called with
+// a node whose children have already been rewritten, and returns it as is
+// to keep it. Spans and resolved functions are kept; the result is neither
+// checked nor optimized again.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if kids := children(node); len(kids) > 0 {
+		rewritten := make([]Node, len(kids))
+		for i, kid := range kids {
+			rewritten[i] = Rewrite(kid, f)
+		}
+		node = withChildren(node, rewritten)
+	}
+	return f(node)
+}
+
+// children returns the operands of node.
+func children(node Node) []Node {
+	switch n := node.(type) {
+	case UnaryNode:
+		return []Node{n.x}
+	case BinaryNode:
+		return []Node{n.x, n.y}
+	case CondNode:
+		return []Node{n.cond, n.x, n.y}
+	case LetNode:
+		return []Node{n.value, n.body}
+	case ArrayNode:
+		return n.args
+	case SetNode:
+		return n.elems
+	case MapNode:
+		nodes := make([]Node, 0, 2*len(n.keys))
+		for i, k := range n.keys {
+			nodes = append(nodes, k, n.vals[i])
+		}
+		return nodes
+	case FuncNode:
+		return n.args
+	case MemberNode:
+		return []Node{n.x}
+	case IndexNode:
+		return []Node{n.x, n.index}
+	}
+	return nil
+}
+
+// withChildren returns node with its operands replaced by kids, in the
+// order children returns them. A set whose elements are no longer all
+// constants turns back into an array.
+func withChildren(node Node, kids []Node) Node {
+	switch n := node.(type) {
+	case UnaryNode:
+		n.x = kids[0]
+		return n
+	case BinaryNode:
+		n.x, n.y = kids[0], kids[1]
+		return n
+	case CondNode:
+		n.cond, n.x, n.y = kids[0], kids[1], kids[2]
+		return n
+	case LetNode:
+		n.value, n.body = kids[0], kids[1]
+		return n
+	case ArrayNode:
+		n.args = kids
+		return n
+	case SetNode:
+		if s, ok := newSet(kids); ok {
+			return SetNode{kids, s, n.span}
+		}
+		return ArrayNode{kids, n.span}
+	case MapNode:
+		n.keys = make([]Node, len(kids)/2)
+		n.vals = make([]Node, len(kids)/2)
+		for i := range n.keys {
+			n.keys[i], n.vals[i] = kids[2*i], kids[2*i+1]
+		}
+		return n
+	case FuncNode:
+		n.args = kids
+		return n
+	case MemberNode:
+		n.x = kids[0]
+		return n
+	case IndexNode:
+		n.x, n.index = kids[0], kids[1]
+		return n
+	}
+	return node
+}
@@ -0,0 +1,46 @@
+package eval
+
+import (
+	"context"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+// Program is an expression compiled to bytecode, ready to be run against
+// many environments.
+type Program struct {
+	node parser.Node
+	prog *parser.Program
+}
+
+// Compile parses and compiles input, with calls resolved against the
+// builtins or the functions given with parser.WithFunctions.
+func Compile(input string, opts ...parser.Option) (*Program, error) {
+	node, err := parser.Parse(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := parser.Compile(node)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{node, prog}, nil
+}
+
+// Node returns the syntax tree of the program.
+func (p *Program) Node() parser.Node {
+	return p.node
+}
+
+// Run evaluates the program in env, which may be a parser.Env or any value
+// parser.EnvOf accepts. Runtime failures are reported as a
+// *parser.EvalError instead of a panic.
+func (p *Program) Run(env interface{}, opts ...parser.EvalOption) (interface{}, error) {
+	return p.prog.Run(env, opts...)
+}
+
+// EvalContext is like Run, but aborts when ctx is done or when the run
+// exceeds limits. The error then wraps ctx.Err() or a *parser.LimitError.
+func (p *Program) EvalContext(ctx context.Context, env interface{}, limits parser.Limits, opts ...parser.EvalOption) (interface{}, error) {
+	return p.prog.RunContext(ctx, env, limits, opts...)
+}
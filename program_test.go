@@ -0,0 +1,531 @@
+package eval
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestRun(t *testing.T) {
+	for _, test := range tests {
+		prog, err := Compile(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got, err := prog.Run(test.env)
+		if err != nil {
+			t.Errorf("%s.Run() in %v: unexpected error %v", test.expr, test.env, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s.Run() in %v = %v, want %v", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr    string
+		env     parser.Env
+		wantErr string
+		op      string
+		fn      string
+		types   []string
+	}{
+		{`"a" - 1`, parser.Env{}, "invalid operation: string - int64", "-", "", []string{"string", "int64"}},
+		{"!x", parser.Env{"x": 1}, "invalid operation: ! int", "!", "", []string{"int"}},
+		{"x + 3", parser.Env{}, "invalid operation: <nil> + int64", "+", "", []string{"<nil>", "int64"}},
+		{"a?.b.c", parser.Env{"a": map[string]interface{}{"b": 1}}, "cannot access field c of int", ".", "", []string{"int"}},
+		{"1 + (a && b)", parser.Env{"a": true, "b": 2}, "invalid operation: bool && int", "&&", "", []string{"bool", "int"}},
+		{"sqrt(s)", parser.Env{"s": "x"}, "invalid arguments: sqrt(string)", "", "sqrt", []string{"string"}},
+		{"x / y", parser.Env{"x": 1, "y": 0}, "runtime error: integer divide by zero", "", "", nil},
+		{"user.nobody.age", parser.Env{"user": user}, "cannot access field age of <nil>", ".", "", []string{"<nil>"}},
+		{"user.p.note", parser.Env{"user": user}, "*eval.profile has no field note", ".", "", []string{"*eval.profile"}},
+		{"user.name.first", parser.Env{"user": user}, "cannot access field first of string", ".", "", []string{"string"}},
+		{"user.profile.tags[2]", parser.Env{"user": user}, "index out of range [2] with length 2", "[]", "", []string{"int64"}},
+		{"user.scores[-1]", parser.Env{"user": user}, "index out of range [-1] with length 3", "[]", "", []string{"int64"}},
+		{"{k: 1}", parser.Env{"k": true}, "invalid map key type bool", "", "", []string{"bool"}},
+		{"x ? 1 : 2", parser.Env{"x": 1}, "invalid condition: int is not bool", "?:", "", []string{"int"}},
+		{"len(n)", parser.Env{"n": 1}, "invalid arguments: len(int)", "", "len", []string{"int"}},
+		{"user.scores[\"a\"]", parser.Env{"user": user}, "invalid operation: cannot index [3]float64 with string", "[]", "", []string{"[3]float64", "string"}},
+		{`x =~ "a"`, parser.Env{"x": 1}, "invalid operation: int =~ string", "=~", "", []string{"int", "string"}},
+		{`s !~ p`, parser.Env{"s": "a", "p": "("}, "error parsing regexp: missing closing ): `(`", "!~", "", nil},
+		{`regex_extract(s, "a", 2)`, parser.Env{"s": "a"}, "regex_extract: no group 2 in a", "", "regex_extract", []string{"string", "string", "int64"}},
+		{"x & 1.5", parser.Env{"x": 1}, "invalid operation: int & float64", "&", "", []string{"int", "float64"}},
+		{"^v", parser.Env{"v": 1.5}, "invalid operation: ^ float64", "^", "", []string{"float64"}},
+		{"1 << n", parser.Env{"n": -1}, "invalid operation: int64 << int (negative shift amount)", "<<", "", []string{"int64", "int"}},
+		{"m >> n", parser.Env{"m": uint8(8), "n": int8(-2)}, "invalid operation: uint8 >> int8 (negative shift amount)", ">>", "", []string{"uint8", "int8"}},
+		{"any(xs, #)", parser.Env{"xs": []int{1}}, "invalid predicate: int is not bool", "", "any", []string{"int"}},
+		{"all(n, # > 0)", parser.Env{"n": 1}, "invalid arguments: all(int)", "", "all", []string{"int"}},
+	} {
+		prog, err := Compile(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, err = prog.Run(test.env)
+		var e *parser.EvalError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got error %v, want *parser.EvalError", test.expr, err)
+			continue
+		}
+		if e.Error() != test.wantErr {
+			t.Errorf("%s: got error %q, want %q", test.expr, e, test.wantErr)
+		}
+		if e.Op != test.op || e.Func != test.fn || !reflect.DeepEqual(e.Types, test.types) {
+			t.Errorf("%s: got op %q func %q types %v, want %q %q %v",
+				test.expr, e.Op, e.Func, e.Types, test.op, test.fn, test.types)
+		}
+		if e.Node == nil {
+			t.Errorf("%s: error does not carry the failing node", test.expr)
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// Every right operand below fails when it is evaluated.
+	for _, test := range []struct {
+		expr string
+		env  parser.Env
+		want interface{}
+	}{
+		{`false && sqrt(s) > 1`, parser.Env{}, false},
+		{`x > 3 && x / y > 1`, parser.Env{"x": 1, "y": 0}, false},
+		{`true || sqrt(s) > 1`, parser.Env{}, true},
+		{`x < 3 or x / y > 1`, parser.Env{"x": 1, "y": 0}, true},
+		{`x > 3 and lower(x) == "a" or true`, parser.Env{"x": 1}, true},
+		{`!(ok || lower(x) == "a")`, parser.Env{"ok": true, "x": 1}, false},
+	} {
+		prog, err := Compile(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got, err := prog.Run(test.env)
+		if err != nil {
+			t.Errorf("%s: right operand was evaluated: %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s in %v = %v, want %v", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+// TestCompiled checks that compiled programs agree with the tree walker,
+// for results as well as for errors.
+func TestCompiled(t *testing.T) {
+	for _, test := range tests {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		prog, err := parser.Compile(node)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		want, wantErr := parser.EvalE(node, test.env)
+		got, err := prog.Run(test.env)
+		if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("%s in %v: compiled = %v, %v, tree = %v, %v\n%v",
+				test.expr, test.env, got, err, want, wantErr, prog)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	node, err := Parse(`a > 0 && lower(name) in ["tom", "jim"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := parser.Compile(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `0000 load          a
+0001 const         0
+0002 gt
+0003 jump_if_false 9
+0004 load          name
+0005 call          lower/1
+0006 const         set{"tom", "jim"}
+0007 in
+0008 and
+`
+	if got := prog.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestLetOnce checks that a let evaluates its value once, however often
+// its body refers to it, and not at all if the body never does.
+func TestLetOnce(t *testing.T) {
+	fs := parser.Builtins()
+	calls := 0
+	fs.Register("tick", func(x int) int {
+		calls++
+		return x + calls
+	})
+	for _, test := range []struct {
+		expr  string
+		want  interface{}
+		calls int
+	}{
+		{"let r = tick(x); any([1, 2, 3], # < r) && r * r == 4 ? r : 0", int64(2), 1},
+		{"let r = tick(x); x > 5 && r > 0", false, 0},
+		{"let r = tick(x); let s = r + 1; x", 1, 0},
+	} {
+		node, err := Parse(test.expr, parser.WithFunctions(fs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := parser.Compile(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, run := range []func() (interface{}, error){
+			func() (interface{}, error) { return parser.EvalE(node, parser.Env{"x": 1}) },
+			func() (interface{}, error) { return prog.Run(parser.Env{"x": 1}) },
+		} {
+			calls = 0
+			got, err := run()
+			if err != nil || got != test.want || calls != test.calls {
+				t.Errorf("%s = %v, %v after %d calls, want %v after %d", test.expr, got, err, calls, test.want, test.calls)
+			}
+		}
+	}
+}
+
+func TestDisassembleEach(t *testing.T) {
+	node, err := Parse("any(xs, # > x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := parser.Compile(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `0000 load          xs
+0001 iter          any/2
+0002 next          7
+0003 elem          0
+0004 load          x
+0005 gt
+0006 step          2
+0007 done
+`
+	if got := prog.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	fs := parser.Builtins()
+	fs.Remove("sin")
+	fs.Add(&parser.Function{
+		Name:   "sqrt",
+		Params: []parser.Param{{Name: "x", Type: parser.IntType}},
+		Result: parser.IntType,
+		Call: func(args []interface{}) (interface{}, error) {
+			return args[0], nil
+		},
+	})
+	fs.Add(&parser.Function{
+		Name: "round",
+		Params: []parser.Param{
+			{Name: "x", Type: parser.FloatType},
+			{Name: "digits", Type: parser.IntType, Optional: true},
+		},
+		Result: parser.FloatType,
+		Call: func(args []interface{}) (interface{}, error) {
+			x, scale := args[0].(float64), 1.0
+			if len(args) > 1 {
+				scale = math.Pow(10, float64(args[1].(int64)))
+			}
+			return math.Round(x*scale) / scale, nil
+		},
+	})
+	if err := fs.Register("join", strings.Join); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Register("max", func(x int, xs ...int) int {
+		for _, y := range xs {
+			if y > x {
+				x = y
+			}
+		}
+		return x
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Register("atoi", strconv.Atoi); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		expr    string
+		env     parser.Env
+		want    interface{}
+		wantErr string
+	}{
+		{"sqrt(4)", parser.Env{}, int64(4), ""},
+		{"[round(2.5), round(3.14159, 2)]", parser.Env{}, []interface{}{3.0, 3.14}, ""},
+		{`join(tags, "-")`, parser.Env{"tags": []string{"a", "b"}}, "a-b", ""},
+		{`join(["a", "b"], "+")`, parser.Env{}, "a+b", ""},
+		{"max(1) + max(3, x, 2)", parser.Env{"x": 7}, int64(8), ""},
+		{"len(name)", parser.Env{"name": "Tom"}, int64(3), ""},
+		{`atoi(s) * 2`, parser.Env{"s": "21"}, int64(42), ""},
+		{`atoi(s)`, parser.Env{"s": "x"}, nil, `strconv.Atoi: parsing "x": invalid syntax`},
+		{`join(s, "")`, parser.Env{"s": 1}, nil, "invalid arguments: join(int, string)"},
+		{"sin(1)", parser.Env{}, nil, "1:1: unknown function sin"},
+		{"sqrt(1.5)", parser.Env{}, nil, "1:6: invalid argument 1 to sqrt: float, expected int"},
+		{"round()", parser.Env{}, nil, "1:1: not enough arguments in call to round"},
+		{"round(1, 2, 3)", parser.Env{}, nil, "1:1: too many arguments in call to round"},
+		{"max()", parser.Env{}, nil, "1:1: not enough arguments in call to max"},
+		{`max(1, "a")`, parser.Env{}, nil, "1:8: invalid argument 2 to max: string, expected int"},
+	} {
+		prog, err := Compile(test.expr, parser.WithFunctions(fs))
+		var got interface{}
+		if err == nil {
+			got, err = prog.Run(test.env)
+		}
+		if err != nil {
+			if err.Error() != test.wantErr {
+				t.Errorf("%s: got error %q, want %q", test.expr, err, test.wantErr)
+			}
+			continue
+		}
+		if test.wantErr != "" || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s in %v = %#v, want %#v (error %q)", test.expr, test.env, got, test.want, test.wantErr)
+		}
+	}
+
+	// the builtins themselves are left alone
+	if _, err := Compile("sin(1)"); err != nil {
+		t.Error(err)
+	}
+	fs["len"].Call = nil
+	fs["len"].Params[0].Type = parser.IntType
+	if f := parser.Builtins()["len"]; f.Call == nil || f.Params[0].Type == parser.IntType {
+		t.Error("changing a function of Builtins changed the builtin")
+	}
+	if prog, err := Compile("len(s)"); err != nil {
+		t.Error(err)
+	} else if got, err := prog.Run(parser.Env{"s": "abc"}); err != nil || got != int64(3) {
+		t.Errorf("len(s) = %v, %v", got, err)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	fs := parser.Functions{}
+	for _, fn := range []interface{}{
+		42,
+		func(x int) {},
+		func(x int) (int, int) { return x, x },
+		func(ch chan int) int { return 0 },
+		func(x int) *int { return &x },
+	} {
+		if err := fs.Register("f", fn); err == nil {
+			t.Errorf("Register(%T) succeeded", fn)
+		}
+	}
+	if len(fs) != 0 {
+		t.Errorf("failed registrations left %v", fs)
+	}
+}
+
+type base struct {
+	ID int `expr:"id"`
+}
+
+type account struct {
+	Name   string                 `expr:"name"`
+	Age    int                    `expr:"age"`
+	Secret string                 `expr:"-"`
+	Meta   map[string]interface{} `expr:"meta"`
+	Tags   []string
+	Boss   *account `expr:"boss"`
+	*base
+}
+
+// countingEnv counts the lookups of each variable.
+type countingEnv map[string]int
+
+func (e countingEnv) Get(name string) (interface{}, bool) {
+	e[name]++
+	if name == "x" {
+		return 10, true
+	}
+	return nil, false
+}
+
+// TestNilEnv checks that Eval(nil) sees no variables, also inside the
+// predicates and lets that bind names of their own.
+func TestNilEnv(t *testing.T) {
+	for _, expr := range []string{
+		"x == null",
+		"any([1], # < default(x, 2) && x == null)",
+		"let r = [1]; r[0] > 0 && x == null",
+	} {
+		if got := mustParse(t, expr).Eval(nil); got != true {
+			t.Errorf("%s.Eval(nil) = %v, want true", expr, got)
+		}
+	}
+}
+
+func TestEnvs(t *testing.T) {
+	tom := &account{
+		Name: "Tom",
+		Age:  20,
+		Meta: map[string]interface{}{"level": "gold"},
+		Tags: []string{"a", "b"},
+		base: &base{ID: 7},
+	}
+	for _, test := range []struct {
+		expr string
+		env  interface{}
+		want interface{}
+	}{
+		{`name == "Tom" && age > 18`, tom, true},
+		{`name == "Tom" && age > 18`, *tom, true},
+		{"meta.level", tom, "gold"},
+		{"Tags[1]", tom, "b"},
+		{"id", tom, 7},
+		{"id", &account{}, nil},
+		{"Secret", tom, nil},
+		{"u.name + u.meta.level", parser.Env{"u": tom}, "Tomgold"},
+		{"u.id", map[string]interface{}{"u": tom}, 7},
+		{"x * 2", map[string]float64{"x": 1.5}, 3.0},
+		{"x + 1", countingEnv{}, int64(11)},
+		{"x", nil, nil},
+		{"x", (*account)(nil), nil},
+		{"boss == null && Tags == null", &account{}, true},
+		{"boss?.age", &account{}, nil},
+		{"boss?.meta.level", tom, nil},
+		{"boss ?? 7", &account{}, int64(7)},
+		{"defined(boss)", tom, false},
+		{`default(boss.name, "none")`, tom, "none"},
+		{"Tags?.[0]", &account{}, nil},
+		{"Tags ?? [1]", &account{}, []interface{}{int64(1)}},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		prog, err := parser.Compile(node)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got, err := prog.Run(test.env)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s.Run() in %#v = %v, %v, want %v", test.expr, test.env, got, err, test.want)
+		}
+		got, err = parser.EvalE(node, test.env)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("EvalE(%s) in %#v = %v, %v, want %v", test.expr, test.env, got, err, test.want)
+		}
+	}
+
+	prog, err := Compile("x + x * x > 100 && y != x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := countingEnv{}
+	if _, err := prog.Run(env); err != nil {
+		t.Fatal(err)
+	}
+	if env["x"] != 1 || env["y"] != 1 {
+		t.Errorf("got lookups %v, want one per variable", env)
+	}
+
+	want := "invalid environment int: want a map with string keys, a struct or a Resolver"
+	if _, err := prog.Run(42); err == nil || err.Error() != want {
+		t.Errorf("Run(42) = %v, want %s", err, want)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	env := parser.Env{
+		"x":    5,
+		"none": nil,
+		"user": map[string]interface{}{"name": "Tom", "tags": []string{"a"}},
+	}
+	for _, test := range []struct {
+		expr    string
+		want    interface{}
+		missing string // undefined variable reported in strict mode
+	}{
+		{"x + 1", int64(6), ""},
+		{"y > 0.86", nil, "y"},
+		{`y not_in ["a"]`, nil, "y"},
+		{"x > 1 || y", true, ""},
+		{"defined(x)", true, ""},
+		{"defined(y)", false, ""},
+		{"defined(none)", false, ""},
+		{"defined(user.name)", true, ""},
+		{"defined(user.profile.age)", false, ""},
+		{"defined(user.tags[0])", true, ""},
+		{"defined(user.tags[3])", false, ""},
+		{"defined(x.name)", false, ""},
+		{"defined(user.tags[i])", nil, "i"},
+		{"default(x, 1)", 5, ""},
+		{"default(y, 1)", int64(1), ""},
+		{`default(user.nick, user.name) + "!"`, "Tom!", ""},
+		{"default(x, y)", 5, ""},
+		{"default(y, z)", nil, "z"},
+		{"defined(y) && y > 1", false, ""},
+		{"y ?? x", 5, ""},
+		{`user.nick ?? user.name`, "Tom", ""},
+		{"y?.name", nil, "y"},
+		{"y ?? z", nil, "z"},
+		{`all(user.tags, # != "")`, true, ""},
+		{"any(user.tags, # == y)", nil, "y"},
+		{"let n = user.name; n + y", nil, "y"},
+		{"let n = user.nick; defined(n) || default(n, x) > 1", true, ""},
+	} {
+		prog, err := Compile(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got, err := prog.Run(env, parser.Strict())
+		if test.missing == "" {
+			if err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: got %v, %v, want %v", test.expr, got, err, test.want)
+			}
+		} else {
+			var undef *parser.UndefinedVariableError
+			if !errors.As(err, &undef) || undef.Name != test.missing {
+				t.Errorf("%s: got error %v, want undefined variable %s", test.expr, err, test.missing)
+			}
+			var e *parser.EvalError
+			if errors.As(err, &e) && (e.Node == nil || test.expr[e.Node.Span().Start.Offset:e.Node.Span().End.Offset] != test.missing) {
+				t.Errorf("%s: error points at %v, want %s", test.expr, e.Node, test.missing)
+			}
+		}
+		// the tree walker agrees
+		want, wantErr := parser.EvalE(prog.Node(), env, parser.Strict())
+		if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("%s: compiled = %v, %v, tree = %v, %v", test.expr, got, err, want, wantErr)
+		}
+	}
+
+	// without Strict, missing variables are nil
+	prog, err := Compile(`y not_in ["a"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := prog.Run(env); got != true || err != nil {
+		t.Errorf("got %v, %v, want true", got, err)
+	}
+}
@@ -0,0 +1,63 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestRegexCompiledOnce(t *testing.T) {
+	node, err := Parse(`title =~ "free[[:space:]]+money" || regex_replace(title, "-+", "-") == p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	parser.Inspect(node, func(n parser.Node) bool {
+		if re, ok := n.(parser.RegexNode); ok {
+			patterns = append(patterns, re.Pattern())
+		}
+		return true
+	})
+	if len(patterns) != 2 || patterns[0] != `free[[:space:]]+money` || patterns[1] != "-+" {
+		t.Errorf("compiled patterns %q", patterns)
+	}
+
+	prog, err := parser.Compile(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `0000 load          title
+0001 const         regexp("free[[:space:]]+money")
+0002 match
+0003 jump_if_true  11
+0004 load          title
+0005 const         regexp("-+")
+0006 const         "-"
+0007 call          regex_replace/3
+0008 load          p
+0009 eq
+0010 or
+`
+	if got := prog.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegexFolding(t *testing.T) {
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{`"abc" =~ "b"`, "true"},
+		{`regex_replace("a--b", "-+", "-")`, `"a-b"`},
+		{`regex_extract("k=v", "([a-z])=", 1) + x`, `"k" + x`},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := parser.Format(node); got != test.want {
+			t.Errorf("%s: optimized to %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
@@ -177,3 +177,31 @@ log(10)             unknown function "log"
 sqrt(1, 2)          call to sqrt has 2 args, want 1
 //!-errors
 */
+
+// probe is an Expr that counts how often it is evaluated.
+type probe struct{ n *int }
+
+func (p probe) Eval(_ Env) float64            { *p.n++; return 1 }
+func (p probe) Check(vars map[Var]bool) error { return nil }
+
+func TestShortCircuit(t *testing.T) {
+	for _, test := range []struct {
+		op    string
+		x     float64
+		want  string
+		evals int // how often the right operand must be evaluated
+	}{
+		{"&&", 0, "0", 0},
+		{"&&", 1, "1", 1},
+		{"||", 1, "1", 0},
+		{"||", 0, "1", 1},
+	} {
+		var n int
+		expr := binary{test.op, literal(test.x), probe{&n}}
+		got := fmt.Sprintf("%.6g", expr.Eval(nil))
+		if got != test.want || n != test.evals {
+			t.Errorf("%g %s probe = %s with %d evaluations of probe, want %s with %d",
+				test.x, test.op, got, n, test.want, test.evals)
+		}
+	}
+}
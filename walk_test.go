@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Cauchy-NY/eval/parser"
+)
+
+func TestInspect(t *testing.T) {
+	node, err := Parse(`a.b[i] > pow(x, 2) ? {"k": -y} : z not_in ["s", "t"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	parser.Inspect(node, func(n parser.Node) bool {
+		if n == nil {
+			got = append(got, ")")
+			return false
+		}
+		got = append(got, strings.TrimPrefix(fmt.Sprintf("%T", n), "parser."))
+		if _, ok := n.(parser.FuncNode); ok {
+			return false // skip the arguments
+		}
+		return true
+	})
+	want := "CondNode BinaryNode IndexNode MemberNode IdentNode ) ) IdentNode ) ) FuncNode ) " +
+		"MapNode StringNode ) UnaryNode IdentNode ) ) ) " +
+		"BinaryNode IdentNode ) SetNode StringNode ) StringNode ) ) ) )"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("Inspect visited\n%s\nwant\n%s", s, want)
+	}
+}
+
+// leaves counts the leaves under each node it visits.
+type leaves struct {
+	count *int
+}
+
+func (v leaves) Visit(node parser.Node) parser.Visitor {
+	switch node.(type) {
+	case parser.IdentNode, parser.IntNode, parser.FloatNode, parser.BoolNode, parser.StringNode:
+		*v.count++
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	node, err := Parse(`f in ["a", x] && len(m[k]) > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	parser.Walk(leaves{&n}, node)
+	if n != 6 {
+		t.Errorf("Walk counted %d leaves, want 6", n)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	// rename user.score to user.rank and wrap lower() around names
+	lower := parser.Builtins()["lower"]
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{`user.score > 0.5 && name == "tom"`, `user.rank > 0.5 && lower(name) == "tom"`},
+		{"score + user.score", "score + user.rank"},
+		{`name in ["tom", "jim"]`, `lower(name) in ["tom", "jim"]`},
+		{`"tom" in [name]`, `"tom" in [lower(name)]`},
+	} {
+		node, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got := parser.Rewrite(node, func(n parser.Node) parser.Node {
+			switch n := n.(type) {
+			case parser.MemberNode:
+				if n.Name() == "score" {
+					return parser.NewMember(n.X(), "rank")
+				}
+			case parser.IdentNode:
+				if n.Name() == "name" {
+					return parser.NewCall(lower, n)
+				}
+			}
+			return n
+		})
+		if s := parser.Format(got); s != test.want {
+			t.Errorf("Rewrite(%s) = %s, want %s", test.expr, s, test.want)
+		}
+		if !sameTree(reflect.ValueOf(node), reflect.ValueOf(mustParse(t, test.expr))) {
+			t.Errorf("Rewrite(%s) modified its input", test.expr)
+		}
+	}
+}
+
+func TestRewriteSet(t *testing.T) {
+	node, err := Parse(`x in ["a", "b"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := parser.Rewrite(node, func(n parser.Node) parser.Node {
+		if s, ok := n.(parser.StringNode); ok {
+			return parser.NewString(strings.ToUpper(s.Value()))
+		}
+		return n
+	})
+	if _, ok := up.(parser.BinaryNode).Y().(parser.SetNode); !ok {
+		t.Errorf("rewritten set is a %T", up.(parser.BinaryNode).Y())
+	}
+	if got, _ := parser.EvalE(up, parser.Env{"x": "B"}); got != true {
+		t.Errorf(`"B" in rewritten set = %v`, got)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	fs := parser.Builtins()
+	node := parser.NewCond(
+		parser.NewBinary(">", parser.NewIdent("x"), parser.NewInt(1)),
+		parser.NewIndex(parser.NewMap(
+			[]parser.Node{parser.NewString("k")},
+			[]parser.Node{parser.NewArray(parser.NewFloat(1.5), parser.NewBool(true))}),
+			parser.NewString("k")),
+		parser.NewCall(fs["len"], parser.NewMember(parser.NewIdent("u"), "tags")),
+	)
+	if s, want := parser.Format(node), `x > 1 ? {"k": [1.5, true]}["k"] : len(u.tags)`; s != want {
+		t.Errorf("Format = %s, want %s", s, want)
+	}
+	if _, err := parser.Check(node, parser.Schema{"x": parser.IntType, "u": parser.AnyType}); err != nil {
+		t.Error(err)
+	}
+	got, err := parser.EvalE(node, parser.Env{"x": 2})
+	if err != nil || !reflect.DeepEqual(got, []interface{}{1.5, true}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	let := parser.NewLet("r", parser.NewBinary("*", parser.NewIdent("x"), parser.NewInt(2)),
+		parser.NewBinary("+", parser.NewLocal("r"), parser.NewLocal("r")))
+	if s, want := parser.Format(let), "let r = x * 2; r + r"; s != want {
+		t.Errorf("Format = %s, want %s", s, want)
+	}
+	if got, err := parser.EvalE(let, parser.Env{"x": 2}); err != nil || got != int64(8) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := parser.EvalE(parser.NewLocal("r"), nil); err == nil {
+		t.Error("unbound local evaluated")
+	}
+	neg := parser.NewUnary("-", parser.NewIdent("x"))
+	if neg.Op() != "-" || neg.X().(parser.IdentNode).Name() != "x" {
+		t.Errorf("accessors of %s", neg)
+	}
+}
+
+func mustParse(t *testing.T, expr string) parser.Node {
+	node, err := Parse(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}